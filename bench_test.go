@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+)
+
+// benchTemplate is a representative chart template: nested control blocks,
+// variables, comments and plain YAML, all unindented.
+const benchTemplate = `{{- if .Values.enabled }}
+{{- range $name, $svc := .Values.services }}
+{{/* Service for {{ $name }} */}}
+{{- $port := $svc.port | default 80 }}
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ include "chart.fullname" $ }}-{{ $name }}
+  labels:
+{{- with $svc.labels }}
+{{ toYaml . | indent 4 }}
+{{- end }}
+spec:
+  ports:
+{{- range $svc.ports }}
+    - port: {{ .port }}
+{{- if .name }}
+      name: {{ .name | quote }}
+{{- else }}
+{{- fail (printf "port %v of %s has no name" .port $name) }}
+{{- end }}
+{{- end }}
+---
+{{- end }}
+{{- end }}
+`
+
+// writeBenchCorpus generates n template files in dir and returns their paths
+// and total size.
+func writeBenchCorpus(b *testing.B, dir string, n int) ([]string, int64) {
+	b.Helper()
+	src := strings.Repeat(benchTemplate, 10)
+	files := make([]string, n)
+	for i := range files {
+		files[i] = filepath.Join(dir, fmt.Sprintf("chart%d", i%80), "templates", fmt.Sprintf("svc%d.yaml", i))
+		if err := os.MkdirAll(filepath.Dir(files[i]), 0o755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(files[i], []byte(src), 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return files, int64(n * len(src))
+}
+
+func BenchmarkProcessFiles(b *testing.B) {
+	files, size := writeBenchCorpus(b, b.TempDir(), 400)
+	config := helmfmt.DefaultConfig()
+
+	jobsList := []int{1}
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		jobsList = append(jobsList, n)
+	}
+	for _, jobs := range jobsList {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			opts := runOptions{check: true, outputFormat: formatText, jobs: jobs}
+			b.SetBytes(size)
+			for b.Loop() {
+				for _, res := range processFiles(files, opts, staticConfig(config)) {
+					if res.Status != statusUnformatted {
+						b.Fatalf("%s: unexpected status %s", res.File, res.Status)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isChartRoot reports whether dir contains a Chart.yaml.
+func isChartRoot(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, "Chart.yaml"))
+	return err == nil && !info.IsDir()
+}
+
+// findCharts returns the chart roots for path. A chart (a directory with
+// Chart.yaml) is returned together with the unpacked subcharts under its
+// charts/ directory, recursively; packaged subcharts (.tgz) are skipped. Any
+// other directory is searched recursively for charts, except for a directory
+// that has a templates/ directory itself, which is treated as a chart for
+// compatibility with charts lacking Chart.yaml.
+func findCharts(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", path)
+	}
+
+	if isChartRoot(path) {
+		charts := []string{path}
+		entries, err := os.ReadDir(filepath.Join(path, "charts"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			sub, err := findCharts(filepath.Join(path, "charts", entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			charts = append(charts, sub...)
+		}
+		return charts, nil
+	}
+
+	if info, err := os.Stat(filepath.Join(path, "templates")); err == nil && info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var charts []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Walk error at %s: %v\n", p, err)
+			return nil
+		}
+		if !d.IsDir() || p == path {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !isChartRoot(p) {
+			return nil
+		}
+		sub, err := findCharts(p)
+		if err != nil {
+			return err
+		}
+		charts = append(charts, sub...)
+		return filepath.SkipDir
+	})
+	return charts, err
+}
+
+// collectChartFiles returns the template files of every chart found under
+// paths, see findCharts. Each chart is only visited once.
+func collectChartFiles(paths []string, configs *configResolver) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		charts, err := findCharts(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(charts) == 0 {
+			return nil, fmt.Errorf("no charts found in %s", path)
+		}
+
+		for _, chart := range charts {
+			key, err := filepath.Abs(chart)
+			if err != nil {
+				key = chart
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			root := filepath.Join(chart, "templates")
+			if info, err := os.Stat(root); err != nil || !info.IsDir() {
+				continue
+			}
+			config, err := configs.forDir(root)
+			if err != nil {
+				return nil, err
+			}
+			chartFiles, err := collectFiles(root, config)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, chartFiles...)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+)
+
+// writeTree creates the given files (relative paths) under dir.
+func writeTree(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, f := range files {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{{- if .Values.enabled }}\n{{- end }}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectChartFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir,
+		// Umbrella chart with an unpacked and a packaged subchart
+		"umbrella/Chart.yaml",
+		"umbrella/templates/app.yaml",
+		"umbrella/charts/db/Chart.yaml",
+		"umbrella/charts/db/templates/_helpers.tpl",
+		"umbrella/charts/db/charts/metrics/Chart.yaml",
+		"umbrella/charts/db/charts/metrics/templates/svc.yml",
+		"umbrella/charts/cache-1.0.0.tgz",
+		// Repository with several charts
+		"repo/charts/a/Chart.yaml",
+		"repo/charts/a/templates/a.yaml",
+		"repo/charts/a/templates/NOTES.txt",
+		"repo/charts/b/Chart.yaml",
+		"repo/charts/b/templates/b.yaml",
+		"repo/.git/charts/c/Chart.yaml",
+		"repo/.git/charts/c/templates/c.yaml",
+		// Legacy chart without Chart.yaml
+		"legacy/templates/l.yaml",
+	)
+
+	tests := []struct {
+		name     string
+		paths    []string
+		expected []string
+	}{
+		{
+			name:  "umbrella chart",
+			paths: []string{"umbrella"},
+			expected: []string{
+				"umbrella/templates/app.yaml",
+				"umbrella/charts/db/templates/_helpers.tpl",
+				"umbrella/charts/db/charts/metrics/templates/svc.yml",
+			},
+		},
+		{
+			name:     "charts below a directory",
+			paths:    []string{"repo"},
+			expected: []string{"repo/charts/a/templates/a.yaml", "repo/charts/b/templates/b.yaml"},
+		},
+		{
+			name:     "several paths, each chart once",
+			paths:    []string{"legacy", "repo/charts/b", "repo"},
+			expected: []string{"legacy/templates/l.yaml", "repo/charts/b/templates/b.yaml", "repo/charts/a/templates/a.yaml"},
+		},
+	}
+
+	config := helmfmt.DefaultConfig()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths, expected []string
+			for _, p := range tt.paths {
+				paths = append(paths, filepath.Join(dir, p))
+			}
+			for _, p := range tt.expected {
+				expected = append(expected, filepath.Join(dir, p))
+			}
+
+			got, err := collectChartFiles(paths, staticConfig(config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected %v, got %v", expected, got)
+			}
+		})
+	}
+
+	if _, err := collectChartFiles([]string{filepath.Join(dir, "umbrella", "templates")}, staticConfig(config)); err == nil {
+		t.Error("expected an error for a directory without charts")
+	}
+}
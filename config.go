@@ -0,0 +1,872 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/BurntSushi/toml"
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are the names of a config file, in lookup order. YAML is a
+// superset of JSON, so every name but ".helmfmt.toml" accepts both; the
+// legacy ".helmfmt" holds JSON.
+var configFileNames = []string{".helmfmt.yaml", ".helmfmt.yml", ".helmfmt.json", ".helmfmt.toml", ".helmfmt"}
+
+// jsonSchema is the subset of JSON Schema used to describe and validate the
+// config file.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	ID                   string                 `json:"$id,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"` // false or *jsonSchema
+	OneOf                []*jsonSchema          `json:"oneOf,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+}
+
+// configSchema returns the JSON Schema of the config file.
+func configSchema() *jsonSchema {
+	zero, one := 0, 1
+	stringList := func(description string) *jsonSchema {
+		return &jsonSchema{Type: "array", Description: description, Items: &jsonSchema{Type: "string"}}
+	}
+	globList := func(description string) *jsonSchema {
+		return &jsonSchema{Type: "array", Description: description, Items: &jsonSchema{Type: "string", Format: "glob"}}
+	}
+	rule := &jsonSchema{
+		Type: "object",
+		Properties: map[string]*jsonSchema{
+			"disabled":    {Type: "boolean", Description: "Turn the rule off."},
+			"exclude":     stringList("Files (globs or regular expressions) the rule doesn't apply to."),
+			"exclude_add": stringList("Files added to the exclude list inherited from other config files."),
+		},
+		AdditionalProperties: false,
+	}
+	indentRule := &jsonSchema{Type: "object", Properties: map[string]*jsonSchema{}, AdditionalProperties: false}
+	for name, property := range rule.Properties {
+		indentRule.Properties[name] = property
+	}
+	indentRule.Properties["match"] = &jsonSchema{
+		Type:        "string",
+		Format:      "regex",
+		Description: "Regular expression matched against the action body; the rule then applies to the actions it matches instead of to the function it is named after.",
+	}
+	return &jsonSchema{
+		Schema:      "https://json-schema.org/draft/2020-12/schema",
+		ID:          "https://github.com/digitalstudium/helmfmt/config.schema.json",
+		Title:       "helmfmt configuration",
+		Description: "Configuration of helmfmt, read from .helmfmt.yaml, .helmfmt.yml, .helmfmt.json, .helmfmt.toml or .helmfmt.",
+		Type:        "object",
+		Properties: map[string]*jsonSchema{
+			"root": {Type: "boolean", Description: "Don't inherit the config files of parent directories and of the home directory."},
+			"extends": {
+				Description: "Config files applied before this one, relative to it.",
+				OneOf:       []*jsonSchema{{Type: "string"}, stringList("")},
+			},
+			"indent_size": {Type: "integer", Minimum: &one, Description: "Spaces per nesting level."},
+			"indent_style": {
+				Type:        "string",
+				Enum:        []string{helmfmt.IndentStyleSpace, helmfmt.IndentStyleTab},
+				Description: "Indent with indent_size spaces per nesting level, or with one tab per level.",
+			},
+			"tab_width": {Type: "integer", Minimum: &one, Description: "Columns between tab stops, used to measure indentation and line lengths."},
+			"warn_tabs": {Type: "boolean", Description: "Warn about YAML lines indented with a tab, which YAML forbids."},
+			"leading_whitespace": {
+				Type:        "string",
+				Enum:        []string{helmfmt.LeadingWhitespaceIndent, helmfmt.LeadingWhitespaceSkip, helmfmt.LeadingWhitespaceTrim},
+				Description: "What to do with a line whose indentation would reach the rendered output: reindent it anyway, leave it alone, or add {{- to it.",
+			},
+			"continuation_indent": {
+				Type:        "string",
+				Enum:        []string{helmfmt.ContinuationFlatten, helmfmt.ContinuationBlock, helmfmt.ContinuationAlign},
+				Description: "Indentation of the lines after the first of a multi-line action: like the tag, a level deeper per open parenthesis, or under the first argument of the open call. Defaults to block with max_line_length, flatten without.",
+			},
+			"max_line_length": {Type: "integer", Minimum: &zero, Description: "Length past which an action starting a line is split across lines; 0 for no limit."},
+			"yaml_aware":      {Type: "boolean", Description: "Also indent actions with a disabled rule when {{- and nindent/indent make their output independent of the line's indentation."},
+			"extensions":      stringList("Extensions of the files formatted in chart mode."),
+			"extensions_add":  stringList("Extensions added to the ones inherited from other config files."),
+			"ignore":          globList("Files to skip: globs matched as in .helmignore."),
+			"ignore_add":      globList("Files added to the ignore list inherited from other config files."),
+			"rules": {
+				Type: "object",
+				Properties: map[string]*jsonSchema{
+					"indent": {
+						Type:                 "object",
+						Description:          "Indentation of actions starting with a function, keyed by function name, or matching a pattern.",
+						AdditionalProperties: indentRule,
+					},
+					"spacing": {
+						Type:        "object",
+						Description: "Whitespace inside actions.",
+						Properties: map[string]*jsonSchema{
+							helmfmt.SpacingDelimiters: rule,
+							helmfmt.SpacingAssignment: rule,
+							helmfmt.SpacingPipe:       rule,
+						},
+						AdditionalProperties: false,
+					},
+					"trim": {
+						Type:        "object",
+						Description: "Trim markers of control tags alone on their line, changed only where the rendered output stays the same.",
+						Properties: map[string]*jsonSchema{
+							helmfmt.TrimAddLeft:   rule,
+							helmfmt.TrimDropRight: rule,
+						},
+						AdditionalProperties: false,
+					},
+				},
+				AdditionalProperties: false,
+			},
+		},
+		AdditionalProperties: false,
+	}
+}
+
+// configFile is a validated config file, kept as JSON to be merged into a
+// config.
+type configFile struct {
+	path    string
+	root    bool          // stops inheritance from parent directories and the home directory
+	data    []byte        // JSON document
+	extends []string      // paths of the files it extends, as written
+	bases   []*configFile // the files it extends, loaded
+}
+
+// layers returns the files to merge for f, the files it extends first.
+func (f *configFile) layers() []*configFile {
+	var layers []*configFile
+	for _, base := range f.bases {
+		layers = append(layers, base.layers()...)
+	}
+	return append(layers, f)
+}
+
+// apply merges the file, and the files it extends, into config. Mappings are
+// merged key by key, so a file setting one field of a rule keeps the others;
+// other values replace the ones in config, except for "_add" keys, whose items
+// are appended to the list they name.
+func (f *configFile) apply(config *helmfmt.Config) error {
+	current, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	var merged map[string]interface{}
+	if err := json.Unmarshal(current, &merged); err != nil {
+		return err
+	}
+	for _, layer := range f.layers() {
+		var value map[string]interface{}
+		if err := json.Unmarshal(layer.data, &value); err != nil {
+			return fmt.Errorf("%s: %w", layer.path, err)
+		}
+		delete(value, "root")
+		delete(value, "extends")
+		if err := mergeSettings(merged, value); err != nil {
+			return fmt.Errorf("%s: %w", layer.path, err)
+		}
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	result := &helmfmt.Config{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+	*config = *result
+	return nil
+}
+
+// listAddKeys are the "_add" keys, each extending the list named by the key
+// without its suffix. Any other key ending in "_add", such as a rule name, is
+// an ordinary key.
+var listAddKeys = []string{"extensions_add", "ignore_add", "exclude_add"}
+
+// mergeSettings merges the decoded JSON mapping src into dst, see apply.
+// Null values count as unset.
+func mergeSettings(dst, src map[string]interface{}) error {
+	var adds []string
+	for key, value := range src {
+		if value == nil {
+			continue
+		}
+		if slices.Contains(listAddKeys, key) {
+			adds = append(adds, key)
+			continue
+		}
+		if m, ok := value.(map[string]interface{}); ok {
+			sub, ok := dst[key].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				dst[key] = sub
+			}
+			if err := mergeSettings(sub, m); err != nil {
+				return err
+			}
+			continue
+		}
+		dst[key] = value
+	}
+
+	// After the plain keys, so that a file may both set and extend a list
+	for _, key := range adds {
+		items, ok := src[key].([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected a list", key)
+		}
+		name := strings.TrimSuffix(key, "_add")
+		list, _ := dst[name].([]interface{})
+		for _, item := range items {
+			if !slices.Contains(list, item) {
+				list = append(list, item)
+			}
+		}
+		dst[name] = list
+	}
+	return nil
+}
+
+// findConfigFile returns the config file of dir, or nil if there is none.
+// Several config files in the same directory are ambiguous and rejected.
+func findConfigFile(dir string) (*configFile, error) {
+	var found []string
+	for _, name := range configFileNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			found = append(found, path)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, nil
+	case 1:
+		return readConfigFile(found[0])
+	default:
+		return nil, fmt.Errorf("several config files in %s: %s", dir, strings.Join(found, ", "))
+	}
+}
+
+// readConfigFile reads and validates the config file at path, and the files
+// it extends.
+func readConfigFile(path string) (*configFile, error) {
+	return readExtendedConfigFile(path, nil)
+}
+
+// readExtendedConfigFile reads the config file at path, reached by extending
+// the files of stack.
+func readExtendedConfigFile(path string, stack []string) (*configFile, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(stack, abs) {
+		return nil, fmt.Errorf("%s: extends itself through %s", path, strings.Join(stack[slices.Index(stack, abs)+1:], ", "))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseConfig(path, data)
+	if err != nil {
+		var ce *configError
+		if errors.As(err, &ce) && ce.line > 0 {
+			return nil, fmt.Errorf("%s:%w", path, err) // path:line:column: message
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f.path = path
+	for _, base := range f.extends {
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(path), base)
+		}
+		b, err := readExtendedConfigFile(base, append(stack, abs))
+		if err != nil {
+			return nil, err
+		}
+		f.bases = append(f.bases, b)
+	}
+	return f, nil
+}
+
+// configError is a problem at a position of a config file. Its message starts
+// with the position, to be prefixed by the file name. Keys of a TOML file have
+// no known position, so their line is 0 and the message starts with the key.
+type configError struct {
+	line, column int
+	key          string // dotted path of the offending key, if any
+	msg          string
+}
+
+func (e *configError) Error() string {
+	if e.line == 0 {
+		if e.key != "" {
+			return fmt.Sprintf("%s: %s", e.key, e.msg)
+		}
+		return e.msg
+	}
+	if e.key != "" {
+		return fmt.Sprintf("%d:%d: %s: %s", e.line, e.column, e.key, e.msg)
+	}
+	return fmt.Sprintf("%d:%d: %s", e.line, e.column, e.msg)
+}
+
+// parseConfig validates the document of the config file name against the
+// schema: TOML for a ".toml" file, YAML or JSON otherwise.
+func parseConfig(name string, data []byte) (*configFile, error) {
+	var root *yaml.Node
+	if filepath.Ext(name) == ".toml" {
+		var err error
+		if root, err = parseTOML(data); err != nil {
+			return nil, err
+		}
+	} else {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, errors.New(strings.TrimPrefix(err.Error(), "yaml: "))
+		}
+		if len(doc.Content) == 0 {
+			return &configFile{data: []byte("{}")}, nil // empty file
+		}
+		root = doc.Content[0]
+	}
+	if err := validateNode(root, configSchema(), ""); err != nil {
+		return nil, err
+	}
+
+	// Keep the document as JSON so the json tags of the config types stay the
+	// only mapping of keys to fields
+	var value map[string]interface{}
+	if err := root.Decode(&value); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	f := &configFile{data: data}
+	f.root, _ = value["root"].(bool)
+	switch extends := value["extends"].(type) {
+	case string:
+		f.extends = []string{extends}
+	case []interface{}:
+		for _, path := range extends {
+			f.extends = append(f.extends, path.(string))
+		}
+	}
+	return f, nil
+}
+
+// parseTOML reads a TOML document as a YAML node, so that it is validated like
+// the other formats. The TOML decoder doesn't keep the positions of keys, so
+// the nodes have none.
+func parseTOML(data []byte) (*yaml.Node, error) {
+	var value map[string]interface{}
+	if _, err := toml.Decode(string(data), &value); err != nil {
+		var pe toml.ParseError
+		if errors.As(err, &pe) {
+			return nil, &configError{line: pe.Position.Line, column: pe.Position.Col, msg: pe.Message}
+		}
+		return nil, err
+	}
+	var root yaml.Node
+	if err := root.Encode(value); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// validateNode checks a YAML node against a schema and returns the first
+// error, pointing at the offending key or value.
+func validateNode(node *yaml.Node, schema *jsonSchema, key string) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	fail := func(n *yaml.Node, format string, args ...interface{}) error {
+		return &configError{line: n.Line, column: n.Column, key: key, msg: fmt.Sprintf(format, args...)}
+	}
+	if node.ShortTag() == "!!null" {
+		return nil // same as leaving the key out
+	}
+	if len(schema.OneOf) > 0 {
+		// Validate against the alternative of the node's kind, so that errors
+		// inside a list or mapping stay precise
+		kinds := map[string]yaml.Kind{"array": yaml.SequenceNode, "object": yaml.MappingNode}
+		for _, alt := range schema.OneOf {
+			kind, ok := kinds[alt.Type]
+			if !ok {
+				kind = yaml.ScalarNode
+			}
+			if kind == node.Kind {
+				return validateNode(node, alt, key)
+			}
+		}
+		return validateNode(node, schema.OneOf[0], key)
+	}
+
+	switch schema.Type {
+	case "object":
+		if node.Kind != yaml.MappingNode {
+			return fail(node, "expected a mapping, got %s", describeNode(node))
+		}
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			childKey := k.Value
+			if key != "" {
+				childKey = key + "." + k.Value
+			}
+			if seen[k.Value] {
+				return &configError{line: k.Line, column: k.Column, msg: fmt.Sprintf("duplicate key %q", childKey)}
+			}
+			seen[k.Value] = true
+
+			child := schema.Properties[k.Value]
+			if child == nil {
+				child, _ = schema.AdditionalProperties.(*jsonSchema)
+			}
+			if child == nil {
+				msg := fmt.Sprintf("unknown key %q", childKey)
+				if s := suggestKey(k.Value, schema.Properties); s != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", s)
+				}
+				return &configError{line: k.Line, column: k.Column, msg: msg}
+			}
+			if err := validateNode(v, child, childKey); err != nil {
+				return err
+			}
+		}
+	case "array":
+		if node.Kind != yaml.SequenceNode {
+			return fail(node, "expected a list, got %s", describeNode(node))
+		}
+		for i, item := range node.Content {
+			if err := validateNode(item, schema.Items, fmt.Sprintf("%s[%d]", key, i)); err != nil {
+				return err
+			}
+		}
+	case "integer", "boolean", "string":
+		tag := map[string]string{"integer": "!!int", "boolean": "!!bool", "string": "!!str"}[schema.Type]
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != tag {
+			return fail(node, "expected %s, got %s", schema.Type, describeNode(node))
+		}
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, node.Value) {
+			return fail(node, "must be one of %s, got %q", strings.Join(schema.Enum, ", "), node.Value)
+		}
+		if schema.Format == "glob" {
+			if _, err := path.Match(node.Value, ""); err != nil {
+				return fail(node, "invalid glob: %v", err)
+			}
+		}
+		if schema.Format == "regex" {
+			if _, err := regexp.Compile(node.Value); err != nil {
+				return fail(node, "invalid regular expression: %s", strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+			}
+		}
+		if schema.Minimum != nil {
+			var n int
+			if err := node.Decode(&n); err != nil || n < *schema.Minimum {
+				return fail(node, "must be at least %d", *schema.Minimum)
+			}
+		}
+	}
+	return nil
+}
+
+// describeNode names the type of a YAML node for error messages.
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	switch node.ShortTag() {
+	case "!!int", "!!float":
+		return fmt.Sprintf("number %s", node.Value)
+	case "!!bool":
+		return fmt.Sprintf("boolean %s", node.Value)
+	case "!!null":
+		return "null"
+	}
+	return fmt.Sprintf("string %q", node.Value)
+}
+
+// suggestKey returns the known key that key most likely misspells, comparing
+// them without case, dashes and underscores.
+func suggestKey(key string, properties map[string]*jsonSchema) string {
+	normalize := func(s string) string {
+		return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(s))
+	}
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if normalize(name) == normalize(key) {
+			return name
+		}
+	}
+	return ""
+}
+
+// vcsDirs mark the root of a repository, where config lookup stops.
+var vcsDirs = []string{".git", ".hg", ".svn"}
+
+// configEnv names a config file to use instead of looking for one.
+const configEnv = "HELMFMT_CONFIG"
+
+// configResolver finds the config of each file, EditorConfig style: the
+// config files of its directory and of every parent directory up to the
+// repository root are merged, the nearest one winning, over the config of the
+// home directory and the defaults. A config file with "root: true" ends the
+// lookup. Resolved configs are cached by directory.
+type configResolver struct {
+	static    *helmfmt.Config             // used for every file if set
+	fixed     bool                        // no lookup: only explicit applies
+	explicit  *configFile                 // file given on the command line
+	home      string                      // home directory, "" if unknown
+	overrides func(*helmfmt.Config) error // command-line overrides, applied last
+
+	mu      sync.Mutex
+	files   map[string]*configFile     // by directory, nil if it has none
+	configs map[string]*helmfmt.Config // by directory
+}
+
+func newConfigResolver(overrides func(*helmfmt.Config) error) *configResolver {
+	home, _ := os.UserHomeDir()
+	return &configResolver{
+		home:      home,
+		overrides: overrides,
+		files:     make(map[string]*configFile),
+		configs:   make(map[string]*helmfmt.Config),
+	}
+}
+
+// loadConfig returns the resolver selected on the command line: the config
+// file at path, or else the one named by $HELMFMT_CONFIG, is used for every
+// template; noConfig uses the defaults; otherwise each template gets the
+// config found from its directory.
+func loadConfig(path string, noConfig bool, overrides func(*helmfmt.Config) error) (*configResolver, error) {
+	if noConfig && path != "" {
+		return nil, fmt.Errorf("--config and --no-config are mutually exclusive")
+	}
+	r := newConfigResolver(overrides)
+	if noConfig {
+		r.fixed = true
+		return r, nil
+	}
+	if path == "" {
+		path = os.Getenv(configEnv)
+	}
+	if path != "" {
+		f, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		r.fixed = true
+		r.explicit = f
+	}
+	return r, nil
+}
+
+// staticConfig returns a resolver that uses config for every file.
+func staticConfig(config *helmfmt.Config) *configResolver {
+	return &configResolver{static: config}
+}
+
+// forFile returns the config of the file at path.
+func (r *configResolver) forFile(path string) (*helmfmt.Config, error) {
+	return r.forDir(filepath.Dir(path))
+}
+
+// forDir returns the config of the files in dir.
+func (r *configResolver) forDir(dir string) (*helmfmt.Config, error) {
+	if r.static != nil {
+		return r.static, nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if config, ok := r.configs[dir]; ok {
+		return config, nil
+	}
+
+	files, err := r.sources(dir)
+	if err != nil {
+		return nil, err
+	}
+	config := helmfmt.DefaultConfig()
+	for _, f := range files {
+		if err := f.apply(config); err != nil {
+			return nil, err
+		}
+	}
+	if r.overrides != nil {
+		if err := r.overrides(config); err != nil {
+			return nil, err
+		}
+	}
+	r.configs[dir] = config
+	return config, nil
+}
+
+// sources returns the config files that apply to the files in the absolute
+// directory dir, farthest first, i.e. in the order they are applied.
+func (r *configResolver) sources(dir string) ([]*configFile, error) {
+	if r.fixed {
+		if r.explicit == nil {
+			return nil, nil
+		}
+		return []*configFile{r.explicit}, nil
+	}
+	chain, err := r.chain(dir)
+	if err != nil {
+		return nil, err
+	}
+	if r.home != "" && (len(chain) == 0 || !chain[len(chain)-1].root) {
+		home, err := r.file(r.home)
+		if err != nil {
+			return nil, err
+		}
+		if home != nil {
+			chain = append(chain, home)
+		}
+	}
+	slices.Reverse(chain)
+	return chain, nil
+}
+
+// chain returns the config files from dir up to the end of the lookup,
+// nearest first. The home directory is skipped, as its config always comes
+// below the project ones.
+func (r *configResolver) chain(dir string) ([]*configFile, error) {
+	var chain []*configFile
+	for {
+		if dir != r.home {
+			f, err := r.file(dir)
+			if err != nil {
+				return nil, err
+			}
+			if f != nil {
+				chain = append(chain, f)
+				if f.root {
+					return chain, nil
+				}
+			}
+		}
+		if isVCSRoot(dir) {
+			return chain, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return chain, nil
+		}
+		dir = parent
+	}
+}
+
+// file returns the cached config file of dir.
+func (r *configResolver) file(dir string) (*configFile, error) {
+	if f, ok := r.files[dir]; ok {
+		return f, nil
+	}
+	f, err := findConfigFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	r.files[dir] = f
+	return f, nil
+}
+
+func isVCSRoot(dir string) bool {
+	for _, name := range vcsDirs {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// configSetting is a value of an effective config and where it came from.
+type configSetting struct {
+	key    string // dotted path, down to a single rule
+	value  string // JSON
+	source string // config file path, "default" or "command line"
+}
+
+// explain returns the settings of the config of the files in dir, sorted by
+// key, each with the source that set it last.
+func (r *configResolver) explain(dir string) ([]configSetting, error) {
+	config := helmfmt.DefaultConfig()
+	source := make(map[string]string)
+	if r.static != nil {
+		// The overrides below must not change the config shared by the files
+		data, err := json.Marshal(r.static)
+		if err != nil {
+			return nil, err
+		}
+		config = &helmfmt.Config{}
+		if err := json.Unmarshal(data, config); err != nil {
+			return nil, err
+		}
+	} else {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		files, err := r.sources(dir)
+		r.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if err := f.apply(config); err != nil {
+				return nil, err
+			}
+			for _, layer := range f.layers() {
+				set, err := flattenSettings(layer.data)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", layer.path, err)
+				}
+				for key := range set {
+					source[key] = layer.path
+				}
+			}
+		}
+	}
+
+	before, err := flattenConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	after := before
+	if r.overrides != nil {
+		if err := r.overrides(config); err != nil {
+			return nil, err
+		}
+		if after, err = flattenConfig(config); err != nil {
+			return nil, err
+		}
+	}
+
+	settings := make([]configSetting, 0, len(after))
+	for key, value := range after {
+		setting := configSetting{key: key, value: value, source: "default"}
+		if value != before[key] {
+			setting.source = "command line"
+		} else if path, ok := source[key]; ok {
+			setting.source = path
+		}
+		settings = append(settings, setting)
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].key < settings[j].key })
+	return settings, nil
+}
+
+// flattenConfig returns the settings of config by key, see flattenSettings.
+func flattenConfig(config *helmfmt.Config) (map[string]string, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return flattenSettings(data)
+}
+
+// flattenSettings returns the values set in a JSON config document by dotted
+// key, down to the fields of rules. An "_add" key counts as setting the list
+// it extends.
+func flattenSettings(data []byte) (map[string]string, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	delete(doc, "root")
+	delete(doc, "extends")
+
+	settings := make(map[string]string)
+	var walk func(prefix string, m map[string]interface{}) error
+	walk = func(prefix string, m map[string]interface{}) error {
+		for key, value := range m {
+			if slices.Contains(listAddKeys, key) {
+				key = strings.TrimSuffix(key, "_add")
+			}
+			key = prefix + key
+			switch value := value.(type) {
+			case nil:
+			case map[string]interface{}:
+				if err := walk(key+".", value); err != nil {
+					return err
+				}
+			default:
+				b, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+				settings[key] = string(b)
+			}
+		}
+		return nil
+	}
+	if err := walk("", doc); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// writeConfigShow prints the effective config of the files at path, a file
+// or a directory, with the source of every value.
+func writeConfigShow(w io.Writer, configs *configResolver, path string) error {
+	dir := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	settings, err := configs.explain(dir)
+	if err != nil {
+		return err
+	}
+	wd, _ := os.Getwd()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, s := range settings {
+		source := s.source
+		if filepath.IsAbs(source) && wd != "" {
+			if rel, err := filepath.Rel(wd, source); err == nil && !strings.HasPrefix(rel, "..") {
+				source = rel
+			}
+		}
+		fmt.Fprintf(tw, "%s: %s\t# %s\n", s.key, s.value, source)
+	}
+	return tw.Flush()
+}
+
+// writeConfigSchema prints the JSON Schema of the config file.
+func writeConfigSchema() error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(configSchema())
+}
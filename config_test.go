@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		file string // name of the config file, .helmfmt.yaml if empty
+		data string
+		err  string // expected error, "" for none
+	}{
+		{
+			name: "yaml",
+			data: "indent_size: 4\nrules:\n  indent:\n    include:\n      disabled: false\n      exclude: [\"templates/_*.tpl\"]\n",
+		},
+		{
+			name: "json indented with tabs",
+			data: "{\n\t\"indent_size\": 4,\n\t\"rules\": {\"indent\": {\"include\": {\"disabled\": false, \"exclude\": [\"templates/_*.tpl\"]}}}\n}\n",
+		},
+		{
+			name: "empty",
+			data: "",
+		},
+		{
+			name: "misspelled key",
+			data: "indentSize: 4\n",
+			err:  `1:1: unknown key "indentSize" (did you mean "indent_size"?)`,
+		},
+		{
+			name: "unknown nested key",
+			data: "rules:\n  spacing:\n    pipes:\n      disabled: false\n",
+			err:  `3:5: unknown key "rules.spacing.pipes"`,
+		},
+		{
+			name: "wrong type",
+			data: "{\n  \"indent_size\": \"4\"\n}\n",
+			err:  `2:18: indent_size: expected integer, got string "4"`,
+		},
+		{
+			name: "list item",
+			data: "extensions:\n  - .yaml\n  - 1\n",
+			err:  `3:5: extensions[1]: expected string, got number 1`,
+		},
+		{
+			name: "minimum",
+			data: "indent_size: 0\n",
+			err:  `1:14: indent_size: must be at least 1`,
+		},
+		{
+			name: "invalid pattern",
+			data: "rules:\n  indent:\n    pipes:\n      match: '|('\n",
+			err:  `4:14: rules.indent.pipes.match: invalid regular expression: missing closing )`,
+		},
+		{
+			name: "invalid glob",
+			data: "ignore: ['templates/[a-']\n",
+			err:  `1:10: ignore[0]: invalid glob: syntax error in pattern`,
+		},
+		{
+			name: "syntax error",
+			data: "rules:\n  indent: [\n",
+			err:  "line 2",
+		},
+		{
+			name: "toml",
+			file: ".helmfmt.toml",
+			data: "indent_size = 4\n\n[rules.indent.include]\ndisabled = false\nexclude = [\"templates/_*.tpl\"]\n",
+		},
+		{
+			name: "empty toml",
+			file: ".helmfmt.toml",
+			data: "",
+		},
+		{
+			name: "toml wrong type",
+			file: ".helmfmt.toml",
+			data: "[rules.indent.include]\ndisabled = \"no\"\n",
+			err:  `rules.indent.include.disabled: expected boolean, got string "no"`,
+		},
+		{
+			name: "toml syntax error",
+			file: ".helmfmt.toml",
+			data: "indent_size = 4\nrules = [\n",
+			err:  "2:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := helmfmt.DefaultConfig()
+			file := tt.file
+			if file == "" {
+				file = ".helmfmt.yaml"
+			}
+			f, err := parseConfig(file, []byte(tt.data))
+			if err == nil {
+				err = f.apply(config)
+			}
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if tt.data != "" && (config.IndentSize != 4 || config.Rules.Indent["include"].Disabled) {
+					t.Errorf("config not loaded: %+v", config)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if f, err := findConfigFile(dir); f != nil || err != nil {
+		t.Fatalf("expected no config file, got %v, %v", f, err)
+	}
+
+	write(".helmfmt.yml", "indent_size: 3\nroot: true\n")
+	config := helmfmt.DefaultConfig()
+	f, err := findConfigFile(dir)
+	if err == nil {
+		err = f.apply(config)
+	}
+	if err != nil || config.IndentSize != 3 || !f.root {
+		t.Fatalf("expected indent_size 3 and root, got %d, %v", config.IndentSize, err)
+	}
+
+	write(".helmfmt", `{"indentSize": 3}`)
+	_, err = findConfigFile(dir)
+	if err == nil || !strings.Contains(err.Error(), "several config files") {
+		t.Errorf("expected an ambiguity error, got %v", err)
+	}
+
+	os.Remove(filepath.Join(dir, ".helmfmt.yml"))
+	_, err = findConfigFile(dir)
+	if err == nil || !strings.HasPrefix(err.Error(), filepath.Join(dir, ".helmfmt")+":1:2: ") {
+		t.Errorf("expected an error pointing at the file, got %v", err)
+	}
+}
+
+func TestConfigResolver(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	write := func(path, data string) {
+		t.Helper()
+		path = filepath.Join(home, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(".helmfmt.yaml", "indent_size: 8\nextensions: [.yaml, .gotmpl]\n")
+	write("repo/.git/HEAD", "")
+	write("repo/.helmfmt.yaml", "indent_size: 4\n")
+	write("repo/charts/app/.helmfmt.yaml", "indent_size: 3\n")
+	write("repo/charts/app/templates/a.yaml", "")
+	write("repo/charts/lib/templates/a.yaml", "")
+	write("repo/charts/own/.helmfmt.yaml", "root: true\nrules:\n  indent:\n    include:\n      disabled: false\n")
+	write("repo/charts/own/templates/a.yaml", "")
+	write("repo/charts/bad/.helmfmt.yaml", "indent_size: two\n")
+
+	tests := []struct {
+		name       string
+		path       string
+		indentSize int
+		gotmpl     bool // the home extensions apply
+		include    bool // the include rule is enabled
+	}{
+		{name: "nearest wins", path: "repo/charts/app/templates/a.yaml", indentSize: 3, gotmpl: true},
+		{name: "repository config", path: "repo/charts/lib/templates/a.yaml", indentSize: 4, gotmpl: true},
+		{name: "root ends the lookup", path: "repo/charts/own/templates/a.yaml", indentSize: 2, include: true},
+		{name: "home config", path: "elsewhere/a.yaml", indentSize: 8, gotmpl: true},
+	}
+
+	configs := newConfigResolver(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := configs.forFile(filepath.Join(home, tt.path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.IndentSize != tt.indentSize {
+				t.Errorf("expected indent_size %d, got %d", tt.indentSize, config.IndentSize)
+			}
+			if gotmpl := len(config.Extensions) == 2 && config.Extensions[1] == ".gotmpl"; gotmpl != tt.gotmpl {
+				t.Errorf("unexpected extensions %v", config.Extensions)
+			}
+			if include := !config.Rules.Indent["include"].Disabled; include != tt.include {
+				t.Errorf("expected include enabled %v, got %v", tt.include, include)
+			}
+		})
+	}
+
+	if _, err := configs.forFile(filepath.Join(home, "repo/charts/bad/templates/a.yaml")); err == nil || !strings.Contains(err.Error(), "indent_size") {
+		t.Errorf("expected the invalid config to be reported, got %v", err)
+	}
+
+	overridden := newConfigResolver(func(config *helmfmt.Config) error {
+		config.IndentSize = 6
+		return nil
+	})
+	if config, err := overridden.forFile(filepath.Join(home, "repo/charts/app/templates/a.yaml")); err != nil || config.IndentSize != 6 {
+		t.Errorf("expected the overrides to win, got %v, %v", config, err)
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	b, err := json.Marshal(configSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema["additionalProperties"] != false {
+		t.Errorf("expected unknown keys to be rejected, got %v", schema["additionalProperties"])
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	for _, key := range []string{"indent_size", "extensions", "ignore", "rules"} {
+		if properties[key] == nil {
+			t.Errorf("schema: missing property %s", key)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Chdir(dir)
+	for name, data := range map[string]string{
+		".helmfmt.yaml":    "indent_size: 3\n",
+		"central.yaml":     "indent_size: 5\n",
+		"from-env.yaml":    "indent_size: 7\n",
+		"invalid.yaml":     "indent_size: 0\n",
+		"chart/Chart.yaml": "name: chart\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		noConfig   bool
+		env        string
+		indentSize int
+		err        string
+	}{
+		{name: "lookup", indentSize: 3},
+		{name: "flag", path: "central.yaml", indentSize: 5},
+		{name: "environment", env: "from-env.yaml", indentSize: 7},
+		{name: "flag over environment", path: "central.yaml", env: "from-env.yaml", indentSize: 5},
+		{name: "no config", noConfig: true, env: "from-env.yaml", indentSize: 2},
+		{name: "both flags", path: "central.yaml", noConfig: true, err: "mutually exclusive"},
+		{name: "invalid file", path: "invalid.yaml", err: "invalid.yaml:1:14: indent_size: must be at least 1"},
+		{name: "missing file", path: "missing.yaml", err: "missing.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(configEnv, tt.env)
+			configs, err := loadConfig(tt.path, tt.noConfig, nil)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := configs.forDir("chart")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.IndentSize != tt.indentSize {
+				t.Errorf("expected indent_size %d, got %d", tt.indentSize, config.IndentSize)
+			}
+		})
+	}
+}
+
+func TestConfigShow(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(dir)
+	for name, data := range map[string]string{
+		".git/HEAD":           "",
+		".helmfmt.yaml":       "indent_size: 4\nextensions: [.yaml]\n",
+		"chart/.helmfmt.json": `{"indent_size": 3, "rules": {"indent": {"include": {"disabled": false}}}}`,
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	flags := &ruleFlags{disableIndent: []string{"include"}, enableSpacing: []string{"pipe"}}
+	configs := newConfigResolver(flags.apply)
+	var out strings.Builder
+	if err := writeConfigShow(&out, configs, "chart"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"extensions":                    "# .helmfmt.yaml",
+		"indent_size: 3":                "# " + filepath.Join("chart", ".helmfmt.json"),
+		"ignore":                        "# default",
+		"rules.indent.include.disabled": "# command line",
+		"rules.indent.include.exclude":  "# default",
+		"rules.indent.printf":           "# default",
+		"rules.spacing.pipe.disabled":   "# command line",
+		"rules.spacing.assignment":      "# default",
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		for prefix, source := range expected {
+			if strings.HasPrefix(line, prefix) {
+				if !strings.HasSuffix(line, source) {
+					t.Errorf("expected %q to come from %q", line, source)
+				}
+				delete(expected, prefix)
+			}
+		}
+	}
+	if len(expected) != 0 {
+		t.Errorf("missing settings %v in:\n%s", expected, out.String())
+	}
+
+	config := helmfmt.DefaultConfig()
+	configs = staticConfig(config)
+	configs.overrides = flags.apply
+	out.Reset()
+	if err := writeConfigShow(&out, configs, "chart"); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`(?m)^rules\.spacing\.pipe\.disabled: false +# command line$`).MatchString(out.String()) {
+		t.Errorf("expected the override in:\n%s", out.String())
+	}
+	if !config.Rules.Spacing["pipe"].Disabled {
+		t.Error("expected the shared config to be left as it was")
+	}
+}
+
+func TestConfigLayering(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	write := func(path, data string) {
+		t.Helper()
+		path = filepath.Join(home, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(".helmfmt.yaml", "rules:\n  indent:\n    include:\n      exclude: [templates/_*.tpl]\n")
+	write("standards/base.yaml", "indent_size: 4\nignore: [templates/tests/*]\n")
+	write("repo/.git/HEAD", "")
+	write("repo/.helmfmt.yaml", strings.Join([]string{
+		"extends: ../standards/base.yaml",
+		"extensions_add: [.gotmpl, .yaml]",
+		"ignore_add: [templates/NOTES.txt]",
+		"rules:",
+		"  indent:",
+		"    include:",
+		"      disabled: false",
+		"      exclude_add: [templates/_ingress.tpl]",
+		"    required:",
+		"      exclude: []",
+		"    tuple_add:",
+		"      disabled: false",
+	}, "\n"))
+
+	config, err := newConfigResolver(nil).forDir(filepath.Join(home, "repo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.IndentSize != 4 {
+		t.Errorf("expected indent_size 4 from the extended file, got %d", config.IndentSize)
+	}
+	if expected := []string{".yaml", ".yml", ".tpl", ".gotmpl"}; !slices.Equal(config.Extensions, expected) {
+		t.Errorf("expected extensions %v, got %v", expected, config.Extensions)
+	}
+	if expected := []string{"templates/tests/*", "templates/NOTES.txt"}; !slices.Equal(config.Ignore, expected) {
+		t.Errorf("expected ignore %v, got %v", expected, config.Ignore)
+	}
+	include := config.Rules.Indent["include"]
+	if expected := []string{"templates/_*.tpl", "templates/_ingress.tpl"}; include.Disabled || !slices.Equal(include.Exclude, expected) {
+		t.Errorf("expected include enabled with exclude %v, got %+v", expected, include)
+	}
+	if required, ok := config.Rules.Indent["required"]; !ok || required.Disabled {
+		t.Errorf("expected a new enabled rule, got %+v", config.Rules.Indent)
+	}
+	if rule, ok := config.Rules.Indent["tuple_add"]; !ok || rule.Disabled {
+		t.Errorf("expected a rule named tuple_add, got %+v", config.Rules.Indent)
+	}
+	if !config.Rules.Indent["tpl"].Disabled {
+		t.Errorf("expected the untouched rules to keep their defaults, got %+v", config.Rules.Indent)
+	}
+
+	write("standards/base.yaml", "extends: [../repo/.helmfmt.yaml]\n")
+	_, err = newConfigResolver(nil).forDir(filepath.Join(home, "repo"))
+	if err == nil || !strings.Contains(err.Error(), "extends itself") {
+		t.Errorf("expected a cycle error, got %v", err)
+	}
+
+	write("standards/base.yaml", "extends: 1\n")
+	_, err = newConfigResolver(nil).forDir(filepath.Join(home, "repo"))
+	if err == nil || !strings.Contains(err.Error(), "base.yaml:1:10: extends: expected string, got number 1") {
+		t.Errorf("expected a type error, got %v", err)
+	}
+}
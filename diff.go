@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// ANSI escape sequences used for colorized diffs.
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// diffOp is a single line of an edit script: ' ' keeps the line, '-' deletes
+// it from the original and '+' inserts it from the formatted text.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// hunk is a group of changes with surrounding context. Line numbers are
+// 1-based, as in unified diff headers.
+type hunk struct {
+	aStart, aLines int
+	bStart, bLines int
+	ops            []diffOp
+}
+
+// unifiedDiff returns a unified diff between orig and formatted, labelled with
+// name, or "" when they are equal. With color set, the output is decorated with
+// ANSI colors for terminals.
+func unifiedDiff(name, orig, formatted string, color bool) string {
+	hunks := makeHunks(diffLines(splitLines(orig), splitLines(formatted)), diffContext)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	paint := func(c, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+
+	var b strings.Builder
+	b.WriteString(paint(colorBold, "--- a/"+name) + "\n")
+	b.WriteString(paint(colorBold, "+++ b/"+name) + "\n")
+	for _, h := range hunks {
+		b.WriteString(paint(colorCyan, fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.aStart, h.aLines), hunkRange(h.bStart, h.bLines))) + "\n")
+		for _, op := range h.ops {
+			line := string(op.kind) + strings.TrimSuffix(op.line, "\n")
+			switch op.kind {
+			case '-':
+				line = paint(colorRed, line)
+			case '+':
+				line = paint(colorGreen, line)
+			}
+			b.WriteString(line + "\n")
+			if !strings.HasSuffix(op.line, "\n") {
+				b.WriteString("\\ No newline at end of file\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// splitLines splits s into lines, keeping the line terminators.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a shortest edit script turning a into b.
+func diffLines(a, b []string) []diffOp {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:pre] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, myers(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, line := range a[len(a)-suf:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// myers implements Myers' O(ND) difference algorithm. trace[d] keeps the
+// furthest reaching x for every diagonal k in [-d, d] after step d, which is
+// all that is needed to walk the edit path back.
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	if n+m == 0 {
+		return nil
+	}
+	maxD := n + m
+	v := make([]int, 2*maxD+2)
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[maxD+k-1] < v[maxD+k+1]) {
+				x = v[maxD+k+1]
+			} else {
+				x = v[maxD+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[maxD+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		trace = append(trace, append([]int(nil), v[maxD-d:maxD+d+1]...))
+		if done {
+			break
+		}
+	}
+
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{'+', b[y-1]})
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x--
+		y--
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// makeHunks groups the changes of an edit script into hunks with the given
+// number of context lines. Changes closer than 2*context lines are merged.
+func makeHunks(ops []diffOp, context int) []hunk {
+	// Line numbers (0-based) in a and b before each op
+	aIdx := make([]int, len(ops)+1)
+	bIdx := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aIdx[i+1], bIdx[i+1] = aIdx[i], bIdx[i]
+		if op.kind != '+' {
+			aIdx[i+1]++
+		}
+		if op.kind != '-' {
+			bIdx[i+1]++
+		}
+	}
+
+	var hunks []hunk
+	i := 0
+	for {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			return hunks
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*context {
+				break
+			}
+			end = next
+		}
+		i = end
+		end += context
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		h := hunk{
+			aStart: aIdx[start] + 1,
+			aLines: aIdx[end] - aIdx[start],
+			bStart: bIdx[start] + 1,
+			bLines: bIdx[end] - bIdx[start],
+			ops:    ops[start:end],
+		}
+		if h.aLines == 0 {
+			h.aStart--
+		}
+		if h.bLines == 0 {
+			h.bStart--
+		}
+		hunks = append(hunks, h)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name      string
+		orig      string
+		formatted string
+		expected  string
+	}{
+		{
+			name:      "equal",
+			orig:      "a\nb\n",
+			formatted: "a\nb\n",
+			expected:  "",
+		},
+		{
+			name:      "single change",
+			orig:      "{{- if .X }}\n{{- $y := 1 }}\n{{- end }}\n",
+			formatted: "{{- if .X }}\n  {{- $y := 1 }}\n{{- end }}\n",
+			expected: "--- a/f.yaml\n+++ b/f.yaml\n@@ -1,3 +1,3 @@\n" +
+				" {{- if .X }}\n-{{- $y := 1 }}\n+  {{- $y := 1 }}\n {{- end }}\n",
+		},
+		{
+			name:      "missing newline at end of file",
+			orig:      "a\nb",
+			formatted: "a\nc\n",
+			expected: "--- a/f.yaml\n+++ b/f.yaml\n@@ -1,2 +1,2 @@\n" +
+				" a\n-b\n\\ No newline at end of file\n+c\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff("f.yaml", tt.orig, tt.formatted, false)
+			if got != tt.expected {
+				t.Errorf("unexpected diff\nExpected:\n%s\nGot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffSeparateHunks(t *testing.T) {
+	var orig, formatted []string
+	for i := 1; i <= 20; i++ {
+		line := fmt.Sprintf("line %d", i)
+		orig = append(orig, line)
+		if i == 2 || i == 18 {
+			line = "  " + line
+		}
+		formatted = append(formatted, line)
+	}
+
+	got := unifiedDiff("f.yaml", strings.Join(orig, "\n")+"\n", strings.Join(formatted, "\n")+"\n", false)
+	headers := []string{"@@ -1,5 +1,5 @@", "@@ -15,6 +15,6 @@"}
+	for _, h := range headers {
+		if !strings.Contains(got, h+"\n") {
+			t.Errorf("expected hunk header %q in diff:\n%s", h, got)
+		}
+	}
+	if n := strings.Count(got, "@@ -"); n != len(headers) {
+		t.Errorf("expected %d hunks, got %d:\n%s", len(headers), n, got)
+	}
+}
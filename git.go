@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitChangedFiles returns the absolute paths of the files added, copied,
+// modified or renamed since ref, including uncommitted changes and untracked
+// files that aren't ignored, or of the staged files if staged is set. Deleted
+// files are left out.
+func gitChangedFiles(ref string, staged bool) (map[string]bool, error) {
+	top, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	top = strings.TrimSpace(top)
+
+	args := []string{"diff", "--name-only", "-z", "--no-renames", "--diff-filter=ACMR"}
+	if staged {
+		args = append(args, "--cached")
+	} else {
+		args = append(args, ref, "--")
+	}
+	out, err := git(args...)
+	if err != nil {
+		return nil, err
+	}
+	if !staged {
+		// Paths relative to the toplevel, like those of git diff
+		untracked, err := git("ls-files", "-z", "--others", "--exclude-standard", "--full-name", ":/")
+		if err != nil {
+			return nil, err
+		}
+		out += untracked
+	}
+
+	changed := make(map[string]bool)
+	for _, name := range strings.Split(out, "\x00") {
+		if name != "" {
+			changed[filepath.Join(top, filepath.FromSlash(name))] = true
+		}
+	}
+	return changed, nil
+}
+
+// git runs a git command in the current directory and returns its output.
+func git(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// filterChanged keeps the files present in changed, keeping their order.
+func filterChanged(files []string, changed map[string]bool) []string {
+	kept := files[:0:0]
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			continue
+		}
+		// The toplevel reported by git has symlinks resolved
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		}
+		if changed[abs] {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+)
+
+func TestGitChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	run := func(args ...string) {
+		t.Helper()
+		if _, err := git(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("init", "-q")
+	run("config", "user.email", "test@example.com")
+	run("config", "user.name", "test")
+	run("config", "commit.gpgsign", "false")
+
+	writeTree(t, dir,
+		"charts/app/Chart.yaml",
+		"charts/app/templates/deployment.yaml",
+		"charts/app/templates/service.yaml",
+		"charts/app/templates/removed.yaml",
+		"charts/app/templates/_helpers.tpl",
+	)
+	run("add", "-A")
+	run("commit", "-q", "-m", "initial")
+
+	write := func(path string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte("{{- if .X }}\n{{- end }}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("charts/app/templates/deployment.yaml") // unstaged change
+	write("charts/app/templates/service.yaml")    // staged change
+	write("charts/app/templates/new.yaml")        // new staged file
+	write("charts/app/values.yaml")               // not a template
+	write("charts/app/templates/untracked.yaml")  // new file, not added
+	run("add", "charts/app/templates/service.yaml", "charts/app/templates/new.yaml", "charts/app/values.yaml")
+	run("rm", "-q", "charts/app/templates/removed.yaml")
+
+	chartFiles, err := collectChartFiles([]string{"."}, staticConfig(helmfmt.DefaultConfig()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		ref      string
+		staged   bool
+		expected []string
+	}{
+		{
+			name:   "changed since HEAD",
+			ref:    "HEAD",
+			staged: false,
+			expected: []string{
+				"charts/app/templates/deployment.yaml",
+				"charts/app/templates/new.yaml",
+				"charts/app/templates/service.yaml",
+				"charts/app/templates/untracked.yaml",
+			},
+		},
+		{
+			name:   "staged",
+			staged: true,
+			expected: []string{
+				"charts/app/templates/new.yaml",
+				"charts/app/templates/service.yaml",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, err := gitChangedFiles(tt.ref, tt.staged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := filterChanged(chartFiles, changed)
+			for i := range got {
+				got[i] = filepath.ToSlash(got[i])
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := gitChangedFiles("no-such-ref", false); err == nil {
+		t.Error("expected an error for an unknown ref")
+	}
+}
@@ -3,6 +3,7 @@ module github.com/digitalstudium/helmfmt
 go 1.25.1
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/spf13/cobra v1.10.1
 	gopkg.in/yaml.v3 v3.0.1
 )
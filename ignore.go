@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+)
+
+// Ignore files looked up in every chart root.
+const (
+	helmIgnoreFile    = ".helmignore"
+	helmfmtIgnoreFile = ".helmfmtignore"
+)
+
+// defaultHelmIgnore are the rules Helm always adds to a chart's .helmignore.
+var defaultHelmIgnore = []string{"templates/.?*"}
+
+// ignoreRules is a parsed .helmignore-style file. Matching follows Helm's
+// pkg/ignore: paths are relative to the chart root, a pattern without a slash
+// matches the base name only, a leading slash anchors it to the root, a
+// trailing slash matches directories only and a leading '!' negates it.
+type ignoreRules struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	raw     string
+	negate  bool
+	mustDir bool
+	match   func(path string) bool
+}
+
+// parseIgnore reads rules from r. Invalid rules are skipped and reported in
+// the returned error.
+func parseIgnore(r io.Reader) (*ignoreRules, error) {
+	rules := &ignoreRules{}
+	var errs []error
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if err := rules.parseRule(s.Text()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return rules, errors.Join(errs...)
+}
+
+// parseIgnoreFile reads rules from path. A missing file yields no rules.
+func parseIgnoreFile(path string) (*ignoreRules, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &ignoreRules{}, nil
+	}
+	if err != nil {
+		return &ignoreRules{}, err
+	}
+	defer f.Close()
+	rules, err := parseIgnore(f)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, err
+}
+
+func (r *ignoreRules) parseRule(rule string) error {
+	rule = strings.TrimSpace(rule)
+	if rule == "" || strings.HasPrefix(rule, "#") {
+		return nil
+	}
+	if strings.Contains(rule, "**") {
+		return fmt.Errorf("rule %q: double-star (**) syntax is not supported", rule)
+	}
+	if _, err := filepath.Match(rule, "abc"); err != nil {
+		return fmt.Errorf("rule %q: %w", rule, err)
+	}
+
+	p := ignorePattern{raw: rule}
+	if strings.HasPrefix(rule, "!") {
+		p.negate = true
+		rule = rule[1:]
+	}
+	if strings.HasSuffix(rule, "/") {
+		p.mustDir = true
+		rule = strings.TrimSuffix(rule, "/")
+	}
+
+	switch {
+	case strings.HasPrefix(rule, "/"):
+		rule = strings.TrimPrefix(rule, "/")
+		p.match = func(path string) bool {
+			ok, _ := filepath.Match(rule, path)
+			return ok
+		}
+	case strings.Contains(rule, "/"):
+		p.match = func(path string) bool {
+			ok, _ := filepath.Match(rule, path)
+			return ok
+		}
+	default:
+		p.match = func(path string) bool {
+			ok, _ := filepath.Match(rule, filepath.Base(path))
+			return ok
+		}
+	}
+	r.patterns = append(r.patterns, p)
+	return nil
+}
+
+// ignore reports whether the chart-relative path matches the rules, with
+// Helm's semantics for a single path.
+func (r *ignoreRules) ignore(path string, isDir bool) bool {
+	if path == "" || path == "." || path == "./" {
+		return false
+	}
+	for _, p := range r.patterns {
+		if p.negate {
+			if p.mustDir && !isDir {
+				return true
+			}
+			if !p.match(path) {
+				return true
+			}
+			continue
+		}
+		if p.mustDir && !isDir {
+			continue
+		}
+		if p.match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored reports whether the chart-relative file path or any of its parent
+// directories is ignored, as Helm skips ignored directories entirely.
+func (r *ignoreRules) ignored(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if r.ignore(filepath.FromSlash(strings.Join(parts[:i], "/")), true) {
+			return true
+		}
+	}
+	return r.ignore(filepath.FromSlash(rel), false)
+}
+
+// fileFilter decides which files are skipped, based on the ignore patterns of
+// their config and the .helmignore and .helmfmtignore files of every chart
+// enclosing a file.
+type fileFilter struct {
+	configs *configResolver
+	verbose bool
+	rules   map[string]*ignoreRules // by ignore file path
+}
+
+func newFileFilter(configs *configResolver, verbose bool) *fileFilter {
+	return &fileFilter{configs: configs, verbose: verbose, rules: make(map[string]*ignoreRules)}
+}
+
+// filter returns the files that are not ignored, keeping their order.
+// Skipped files are reported in verbose mode.
+func (f *fileFilter) filter(files []string) []string {
+	kept := files[:0:0]
+	for _, file := range files {
+		if reason := f.skipReason(file); reason != "" {
+			if f.verbose {
+				fmt.Fprintf(os.Stderr, "[SKIPPED] %s (%s)\n", file, reason)
+			}
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept
+}
+
+// skipReason returns why file is ignored, or "" if it is not. A file whose
+// config can't be loaded is kept, so that the error gets reported.
+func (f *fileFilter) skipReason(file string) string {
+	config, err := f.configs.forFile(file)
+	if err != nil {
+		return ""
+	}
+	if config.Ignored(file) {
+		return "ignored by config"
+	}
+
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return ""
+	}
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		if isChartRoot(dir) {
+			if reason := f.chartSkipReason(config, dir, abs); reason != "" {
+				return reason
+			}
+		}
+		if filepath.Dir(dir) == dir {
+			return ""
+		}
+	}
+}
+
+// chartSkipReason checks the absolute file path against the ignore rules of
+// the chart rooted at dir.
+func (f *fileFilter) chartSkipReason(config *helmfmt.Config, dir, file string) string {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil {
+		return ""
+	}
+	if config.Ignored(rel) {
+		return "ignored by config"
+	}
+	for _, name := range []string{helmIgnoreFile, helmfmtIgnoreFile} {
+		ignoreFile := filepath.Join(dir, name)
+		if f.load(ignoreFile, name == helmIgnoreFile).ignored(rel) {
+			if wd, err := os.Getwd(); err == nil {
+				if r, err := filepath.Rel(wd, ignoreFile); err == nil {
+					ignoreFile = r
+				}
+			}
+			return "ignored by " + ignoreFile
+		}
+	}
+	return ""
+}
+
+// load returns the cached rules of ignoreFile, parsing it on first use.
+func (f *fileFilter) load(ignoreFile string, helmDefaults bool) *ignoreRules {
+	if rules, ok := f.rules[ignoreFile]; ok {
+		return rules
+	}
+	rules, err := parseIgnoreFile(ignoreFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if helmDefaults {
+		for _, rule := range defaultHelmIgnore {
+			rules.parseRule(rule)
+		}
+	}
+	f.rules[ignoreFile] = rules
+	return rules
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules, err := parseIgnore(strings.NewReader(`
+# comment
+*.bak
+/templates/generated-*.yaml
+templates/vendor/
+**/bad
+`))
+	if err == nil {
+		t.Error("expected an error for the double-star rule")
+	}
+
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"templates/deployment.yaml", false},
+		{"templates/deployment.yaml.bak", true},
+		{"templates/sub/old.bak", true},
+		{"templates/generated-crds.yaml", true},
+		{"templates/sub/generated-crds.yaml", false},
+		{"templates/vendor/x.yaml", true},
+		{"templates/vendor", false},
+	}
+	for _, tt := range tests {
+		if got := rules.ignored(filepath.FromSlash(tt.path)); got != tt.ignored {
+			t.Errorf("%s: expected ignored=%v, got %v", tt.path, tt.ignored, got)
+		}
+	}
+}
+
+func TestFileFilter(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir,
+		"chart/Chart.yaml",
+		"chart/templates/app.yaml",
+		"chart/templates/.hidden.yaml",
+		"chart/templates/vendor/lib.tpl",
+		"chart/templates/generated.yaml",
+		"chart/templates/tests/test.yaml",
+		"chart/charts/sub/Chart.yaml",
+		"chart/charts/sub/templates/sub.yaml",
+		"chart/charts/sub/templates/skip.yaml",
+	)
+	if err := os.WriteFile(filepath.Join(dir, "chart", helmIgnoreFile), []byte("vendor/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "chart", helmfmtIgnoreFile), []byte("generated.yaml\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "chart", "charts", "sub", helmIgnoreFile), []byte("skip.yaml\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := helmfmt.DefaultConfig()
+	config.Ignore = []string{"templates/tests/*"}
+
+	files, err := collectChartFiles([]string{filepath.Join(dir, "chart")}, staticConfig(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := newFileFilter(staticConfig(config), false).filter(files)
+	expected := []string{
+		filepath.Join(dir, "chart", "templates", "app.yaml"),
+		filepath.Join(dir, "chart", "charts", "sub", "templates", "sub.yaml"),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+)
+
+// LSP text document sync kinds and diagnostic severities used by the server.
+const (
+	lspSyncFull      = 1
+	lspSeverityError = 1
+)
+
+// JSON-RPC error codes.
+const (
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+	lspInternalError  = -32603
+)
+
+// lspServer is a Language Server Protocol server over a stream, typically
+// stdio. It keeps the text of open documents, publishes syntax errors as
+// diagnostics and answers formatting requests. Requests are handled one at a
+// time in the order they arrive.
+type lspServer struct {
+	in       *bufio.Reader
+	out      io.Writer
+	configs  *configResolver
+	docs     map[string]string // text of open documents by URI
+	shutdown bool
+}
+
+func newLSPServer(in io.Reader, out io.Writer, configs *configResolver) *lspServer {
+	return &lspServer{in: bufio.NewReader(in), out: out, configs: configs, docs: make(map[string]string)}
+}
+
+type lspMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type (
+	lspPosition struct {
+		Line      int `json:"line"`
+		Character int `json:"character"`
+	}
+	lspRange struct {
+		Start lspPosition `json:"start"`
+		End   lspPosition `json:"end"`
+	}
+	lspTextEdit struct {
+		Range   lspRange `json:"range"`
+		NewText string   `json:"newText"`
+	}
+	lspDiagnostic struct {
+		Range    lspRange `json:"range"`
+		Severity int      `json:"severity"`
+		Source   string   `json:"source"`
+		Message  string   `json:"message"`
+	}
+	lspDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text,omitempty"`
+	}
+	lspDocumentParams struct {
+		TextDocument   lspDocument `json:"textDocument"`
+		ContentChanges []struct {
+			Text string `json:"text"`
+		} `json:"contentChanges"`
+		Range    lspRange    `json:"range"`
+		Position lspPosition `json:"position"`
+		Ch       string      `json:"ch"`
+	}
+)
+
+// serve reads and handles messages until the client sends "exit" or closes
+// the stream.
+func (s *lspServer) serve() error {
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+
+		result, rerr := s.handle(msg)
+		if msg.ID == nil {
+			continue // notification
+		}
+		if rerr != nil {
+			err = s.write(struct {
+				JSONRPC string          `json:"jsonrpc"`
+				ID      json.RawMessage `json:"id"`
+				Error   *lspError       `json:"error"`
+			}{"2.0", msg.ID, rerr})
+		} else {
+			err = s.write(struct {
+				JSONRPC string          `json:"jsonrpc"`
+				ID      json.RawMessage `json:"id"`
+				Result  interface{}     `json:"result"`
+			}{"2.0", msg.ID, result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// read reads one message framed with a Content-Length header.
+func (s *lspServer) read() (*lspMessage, error) {
+	header, err := textproto.NewReader(s.in).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || (len(header) == 0 && err == io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+	var msg lspMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("decoding message: %w", err)
+	}
+	return &msg, nil
+}
+
+func (s *lspServer) write(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *lspServer) notify(method string, params interface{}) error {
+	return s.write(struct {
+		JSONRPC string      `json:"jsonrpc"`
+		Method  string      `json:"method"`
+		Params  interface{} `json:"params"`
+	}{"2.0", method, params})
+}
+
+// handle dispatches a request or notification and returns the result of a
+// request.
+func (s *lspServer) handle(msg *lspMessage) (interface{}, *lspError) {
+	var params lspDocumentParams
+	if len(msg.Params) > 0 && strings.HasPrefix(msg.Method, "textDocument/") {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+		}
+	}
+	uri := params.TextDocument.URI
+
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":                lspSyncFull,
+				"documentFormattingProvider":      true,
+				"documentRangeFormattingProvider": true,
+				"documentOnTypeFormattingProvider": map[string]interface{}{
+					"firstTriggerCharacter": "}",
+				},
+			},
+			"serverInfo": map[string]string{"name": "helmfmt", "version": Version},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		s.docs[uri] = params.TextDocument.Text
+		s.publishDiagnostics(uri)
+	case "textDocument/didChange":
+		if n := len(params.ContentChanges); n > 0 {
+			s.docs[uri] = params.ContentChanges[n-1].Text
+		}
+		s.publishDiagnostics(uri)
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": []lspDiagnostic{}})
+	case "textDocument/formatting":
+		return s.formatting(uri)
+	case "textDocument/rangeFormatting":
+		end := params.Range.End.Line
+		if params.Range.End.Character == 0 && end > params.Range.Start.Line {
+			end-- // the range stops at the start of this line
+		}
+		return s.rangeFormatting(uri, helmfmt.LineRange{Start: params.Range.Start.Line + 1, End: end + 1}, true)
+	case "textDocument/onTypeFormatting":
+		return s.onTypeFormatting(uri, params.Position, params.Ch)
+	default:
+		if msg.ID != nil {
+			return nil, &lspError{Code: lspMethodNotFound, Message: "method not found: " + msg.Method}
+		}
+	}
+	return nil, nil
+}
+
+// publishDiagnostics reports the syntax error of a document, if any.
+func (s *lspServer) publishDiagnostics(uri string) {
+	diagnostics := []lspDiagnostic{}
+	text := s.docs[uri]
+	if err := helmfmt.Validate([]byte(text)); err != nil {
+		fe := syntaxError(err)
+		message := fe.Message
+		if loc := errorPositionRe.FindStringIndex(message); loc != nil {
+			message = strings.TrimSpace(message[loc[1]:])
+		}
+		lines := strings.Split(text, "\n")
+		line := min(max(fe.Line-1, 0), len(lines)-1)
+		start := 0
+		if fe.Column > 0 {
+			start = utf16Len(lines[line][:min(fe.Column-1, len(lines[line]))])
+		}
+		diagnostics = append(diagnostics, lspDiagnostic{
+			Range: lspRange{
+				Start: lspPosition{Line: line, Character: start},
+				End:   lspPosition{Line: line, Character: utf16Len(lines[line])},
+			},
+			Severity: lspSeverityError,
+			Source:   "helmfmt",
+			Message:  message,
+		})
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": diagnostics})
+}
+
+// formatting returns the edits turning the document into its formatted text,
+// one per changed line or block of lines: replacing the whole document would
+// lose the cursor position and undo history in editors. A document with
+// invalid syntax is left alone; the error is already shown as a diagnostic.
+func (s *lspServer) formatting(uri string) (interface{}, *lspError) {
+	text, ok := s.docs[uri]
+	if !ok {
+		return nil, &lspError{Code: lspInvalidParams, Message: "unknown document: " + uri}
+	}
+	config, lerr := s.config(uri)
+	if lerr != nil {
+		return nil, lerr
+	}
+	formatted, err := helmfmt.Format([]byte(text), helmfmt.Options{Config: config, Filename: uriToPath(uri)})
+	if err != nil {
+		return []lspTextEdit{}, nil
+	}
+	return lineEdits(text, string(formatted)), nil
+}
+
+// rangeFormatting formats the lines of r. Unless validate is set, the lines
+// are formatted even if the template doesn't parse, as is usual while typing.
+func (s *lspServer) rangeFormatting(uri string, r helmfmt.LineRange, validate bool) (interface{}, *lspError) {
+	text, ok := s.docs[uri]
+	if !ok {
+		return nil, &lspError{Code: lspInvalidParams, Message: "unknown document: " + uri}
+	}
+	config, lerr := s.config(uri)
+	if lerr != nil {
+		return nil, lerr
+	}
+	formatted, err := helmfmt.Format([]byte(text), helmfmt.Options{
+		Config:         config,
+		Filename:       uriToPath(uri),
+		Lines:          []helmfmt.LineRange{r},
+		SkipValidation: !validate,
+	})
+	if err != nil {
+		return []lspTextEdit{}, nil
+	}
+	return lineEdits(text, string(formatted)), nil
+}
+
+// onTypeFormatting formats the current line once a tag is closed with "}}".
+func (s *lspServer) onTypeFormatting(uri string, pos lspPosition, ch string) (interface{}, *lspError) {
+	lines := strings.Split(s.docs[uri], "\n")
+	if ch != "}" || pos.Line >= len(lines) || !strings.Contains(lines[pos.Line], "}}") {
+		return []lspTextEdit{}, nil
+	}
+	return s.rangeFormatting(uri, helmfmt.LineRange{Start: pos.Line + 1, End: pos.Line + 1}, false)
+}
+
+// config returns the config of a document: the one found from its directory
+// for a file, the one of the current directory otherwise.
+func (s *lspServer) config(uri string) (*helmfmt.Config, *lspError) {
+	dir := "."
+	if path := uriToPath(uri); path != uri {
+		dir = filepath.Dir(path)
+	}
+	config, err := s.configs.forDir(dir)
+	if err != nil {
+		return nil, &lspError{Code: lspInternalError, Message: err.Error()}
+	}
+	return config, nil
+}
+
+// lineEdits returns one edit per changed line, or per changed block of lines
+// when formatting added some, as wrapping long actions does.
+func lineEdits(orig, formatted string) []lspTextEdit {
+	edits := []lspTextEdit{}
+	origLines := strings.Split(orig, "\n")
+	formattedLines := strings.Split(formatted, "\n")
+	if len(origLines) != len(formattedLines) {
+		return blockEdits(origLines, formattedLines)
+	}
+	for i := range origLines {
+		if origLines[i] == formattedLines[i] {
+			continue
+		}
+		edits = append(edits, lspTextEdit{
+			Range: lspRange{
+				Start: lspPosition{Line: i},
+				End:   lspPosition{Line: i, Character: utf16Len(origLines[i])},
+			},
+			NewText: formattedLines[i],
+		})
+	}
+	return edits
+}
+
+// blockEdits returns one edit per run of changed lines between origLines and
+// formattedLines, replacing whole lines.
+func blockEdits(origLines, formattedLines []string) []lspTextEdit {
+	edits := []lspTextEdit{}
+	ops := diffLines(origLines, formattedLines)
+	line := 0
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			line++
+			i++
+			continue
+		}
+		start := line
+		var inserted []string
+		for ; i < len(ops) && ops[i].kind != ' '; i++ {
+			if ops[i].kind == '-' {
+				line++
+			} else {
+				inserted = append(inserted, ops[i].line)
+			}
+		}
+		// Replace up to the start of the next line, or up to the end of the
+		// text for a run that includes the last line
+		from, to := lspPosition{Line: start}, lspPosition{Line: line}
+		text := strings.Join(inserted, "\n")
+		switch last := len(origLines) - 1; {
+		case start > last:
+			from = lspPosition{Line: last, Character: utf16Len(origLines[last])}
+			to, text = from, "\n"+text
+		case line > last:
+			to = lspPosition{Line: last, Character: utf16Len(origLines[last])}
+		default:
+			if len(inserted) > 0 {
+				text += "\n"
+			}
+		}
+		edits = append(edits, lspTextEdit{
+			Range:   lspRange{Start: from, End: to},
+			NewText: text,
+		})
+	}
+	return edits
+}
+
+// utf16Len returns the length of s in UTF-16 code units, the unit of LSP
+// character offsets.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// uriToPath returns the file path of a file:// URI, used to match exclude
+// patterns. Other URIs are returned unchanged.
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
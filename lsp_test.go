@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+)
+
+// lspScript is a scripted LSP client: it queues messages for the server and
+// decodes everything the server wrote back.
+type lspScript struct {
+	in     bytes.Buffer
+	nextID int
+}
+
+func (c *lspScript) send(method string, params interface{}, request bool) int {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	id := 0
+	if request {
+		c.nextID++
+		id = c.nextID
+		msg["id"] = id
+	}
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(&c.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return id
+}
+
+type lspReply struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *lspError       `json:"error"`
+}
+
+// run serves the queued messages and returns the replies by request ID and
+// the notifications in order.
+func (c *lspScript) run(t *testing.T) (map[int]lspReply, []lspReply) {
+	t.Helper()
+	var out bytes.Buffer
+	if err := newLSPServer(&c.in, &out, staticConfig(helmfmt.DefaultConfig())).serve(); err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+
+	replies := make(map[int]lspReply)
+	var notifications []lspReply
+	r := bufio.NewReader(&out)
+	for {
+		header, err := textproto.NewReader(r).ReadMIMEHeader()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading header: %v", err)
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			t.Fatalf("reading body: %v", err)
+		}
+		var reply lspReply
+		if err := json.Unmarshal(body, &reply); err != nil {
+			t.Fatalf("decoding %s: %v", body, err)
+		}
+		if reply.Method != "" {
+			notifications = append(notifications, reply)
+		} else {
+			replies[reply.ID] = reply
+		}
+	}
+	return replies, notifications
+}
+
+func TestLSPServer(t *testing.T) {
+	const uri = "file:///chart/templates/a.yaml"
+	const unterminated = "file:///chart/templates/b.yaml"
+	doc := func() map[string]string { return map[string]string{"uri": uri} }
+	text := "{{- if .X }}\n{{- $a := 1 }}\n{{- $b := 2 }}\n{{- end }}\n"
+	broken := "{{- if .X }}\n{{- $a := 1 }}\n"
+
+	var c lspScript
+	initID := c.send("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, true)
+	c.send("initialized", map[string]interface{}{}, false)
+	c.send("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "helm", "version": 1, "text": text},
+	}, false)
+	formatID := c.send("textDocument/formatting", map[string]interface{}{"textDocument": doc()}, true)
+	c.send("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": unterminated, "languageId": "helm", "version": 1, "text": "a: 1"},
+	}, false)
+	newlineID := c.send("textDocument/formatting", map[string]interface{}{"textDocument": map[string]string{"uri": unterminated}}, true)
+	rangeID := c.send("textDocument/rangeFormatting", map[string]interface{}{
+		"textDocument": doc(),
+		"range":        map[string]interface{}{"start": map[string]int{"line": 2}, "end": map[string]int{"line": 3}},
+	}, true)
+	c.send("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]string{{"text": broken}},
+	}, false)
+	typeID := c.send("textDocument/onTypeFormatting", map[string]interface{}{
+		"textDocument": doc(),
+		"position":     map[string]int{"line": 1, "character": 14},
+		"ch":           "}",
+	}, true)
+	unknownID := c.send("textDocument/hover", map[string]interface{}{"textDocument": doc()}, true)
+	c.send("shutdown", nil, true)
+	c.send("exit", nil, false)
+
+	replies, notifications := c.run(t)
+
+	var init struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	json.Unmarshal(replies[initID].Result, &init)
+	for _, capability := range []string{"documentFormattingProvider", "documentRangeFormattingProvider", "documentOnTypeFormattingProvider"} {
+		if init.Capabilities[capability] == nil {
+			t.Errorf("initialize: missing capability %s", capability)
+		}
+	}
+
+	edits := func(id int) []lspTextEdit {
+		var e []lspTextEdit
+		if err := json.Unmarshal(replies[id].Result, &e); err != nil {
+			t.Fatalf("request %d: decoding %s: %v", id, replies[id].Result, err)
+		}
+		return e
+	}
+
+	if e := edits(formatID); len(e) != 2 || e[0].Range.Start.Line != 1 || e[0].NewText != "  {{- $a := 1 }}" || e[1].Range.Start.Line != 2 {
+		t.Errorf("formatting: unexpected edits %+v", e)
+	}
+	end := lspPosition{Line: 0, Character: 4}
+	if e := edits(newlineID); len(e) != 1 || e[0].Range != (lspRange{Start: end, End: end}) || e[0].NewText != "\n" {
+		t.Errorf("formatting: expected the final newline to be inserted, got %+v", e)
+	}
+
+	if e := edits(rangeID); len(e) != 1 || e[0].Range.Start.Line != 2 || e[0].NewText != "  {{- $b := 2 }}" {
+		t.Errorf("rangeFormatting: unexpected edits %+v", e)
+	}
+
+	// The document no longer parses, yet the typed line is indented
+	if e := edits(typeID); len(e) != 1 || e[0].Range.Start.Line != 1 || e[0].NewText != "  {{- $a := 1 }}" {
+		t.Errorf("onTypeFormatting: unexpected edits %+v", e)
+	}
+
+	if replies[unknownID].Error == nil || replies[unknownID].Error.Code != lspMethodNotFound {
+		t.Errorf("hover: expected method not found, got %+v", replies[unknownID])
+	}
+
+	var diagnostics []int
+	for _, n := range notifications {
+		var params struct {
+			Diagnostics []lspDiagnostic `json:"diagnostics"`
+		}
+		json.Unmarshal(n.Params, &params)
+		diagnostics = append(diagnostics, len(params.Diagnostics))
+	}
+	if len(diagnostics) != 3 || diagnostics[0] != 0 || diagnostics[1] != 0 || diagnostics[2] != 1 {
+		t.Errorf("expected no diagnostics on open and one after the change, got %v", diagnostics)
+	}
+}
+
+func TestLineEdits(t *testing.T) {
+	orig := "a:\n{{- $x := merge (dict) (dict) }}\nb: 1\n"
+	formatted := "a:\n{{- $x := merge\n  (dict) (dict) }}\nb: 1\n"
+	edits := lineEdits(orig, formatted)
+	want := []lspTextEdit{{
+		Range:   lspRange{Start: lspPosition{Line: 1}, End: lspPosition{Line: 2}},
+		NewText: "{{- $x := merge\n  (dict) (dict) }}\n",
+	}}
+	if !reflect.DeepEqual(edits, want) {
+		t.Errorf("expected %+v, got %+v", want, edits)
+	}
+}
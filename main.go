@@ -1,76 +1,40 @@
-// Package main implements helmfmt.
-//
-//go:generate go run gen_stubs.go
+// Package main implements the helmfmt command line. The formatter itself
+// lives in pkg/helmfmt.
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
 	"github.com/spf13/cobra"
 )
 
 // Version can be set at build time with -ldflags "-X main.Version=v1.2.3"
 var Version = "dev"
 
-type Config struct {
-	IndentSize int         `json:"indent_size"`
-	Extensions []string    `json:"extensions"`
-	Rules      RulesConfig `json:"rules"`
-}
-
-type RulesConfig struct {
-	Indent map[string]RuleConfig `json:"indent"`
-}
-
-type RuleConfig struct {
-	Disabled bool     `json:"disabled"`
-	Exclude  []string `json:"exclude"`
-}
+// runOptions holds the output mode selected on the command line.
+type runOptions struct {
+	stdout bool // print formatted files instead of writing them
+	check  bool // only report unformatted files
+	diff   bool // print a unified diff of the changes
+	color  bool // colorize diffs
 
-func loadConfig() *Config {
-	// Default config
-	config := &Config{
-		IndentSize: 2,
-		Extensions: []string{".yaml", ".yml", ".tpl"},
-		Rules: RulesConfig{
-			Indent: map[string]RuleConfig{
-				"tpl":      {Disabled: true, Exclude: []string{}},
-				"toYaml":   {Disabled: true, Exclude: []string{}},
-				"template": {Disabled: true, Exclude: []string{}},
-				"include":  {Disabled: true, Exclude: []string{}},
-				"printf":   {Disabled: false, Exclude: []string{}},
-				"fail":     {Disabled: false, Exclude: []string{}},
-			},
-		},
-	}
-
-	// Try to load from home directory first
-	if homeDir, err := os.UserHomeDir(); err == nil {
-		homeConfigPath := filepath.Join(homeDir, ".helmfmt")
-		loadConfigFile(homeConfigPath, config)
-	}
+	outputFormat string // report format, one of outputFormats
+	jobs         int    // number of files processed concurrently
+	verbose      bool   // report skipped files
 
-	// Try to load from current directory (overrides home config)
-	loadConfigFile(".helmfmt", config)
+	lines []helmfmt.LineRange // only rewrite these lines, if any
 
-	return config
-}
-
-func loadConfigFile(path string, config *Config) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return // File doesn't exist, skip silently
-	}
-
-	if err := json.Unmarshal(data, config); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: Error parsing config from %s: %v\n", path, err)
-	}
+	verifier *renderVerifier // checks the rendered output of changed files, if set
 }
 
 func main() {
@@ -78,55 +42,106 @@ func main() {
 }
 
 func run() int {
-	config := loadConfig()
-	var stdout, files, check bool
-	var disableRules, enableRules []string
+	var files bool
+	var opts runOptions
+	var rules ruleFlags
+	var lines []string
+	var changedSince string
+	var staged bool
+	var verify string
+	var valuesFiles []string
+	var configPath string
+	var noConfig bool
 
 	var rootCmd = &cobra.Command{
-		Use:     "helmfmt [flags] [chart-path | file1 file2 ...]",
+		Use:     "helmfmt [flags] [chart-path ... | --files file1 file2 ...]",
 		Short:   "Format Helm templates",
 		Version: Version,
+		// Chart paths, not subcommand names
+		Args: cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if check && stdout {
+			if opts.check && opts.stdout {
 				return fmt.Errorf("--check and --stdout are mutually exclusive")
 			}
-
-			// Apply rule overrides from flags
-			for _, rule := range disableRules {
-				if _, exists := config.Rules.Indent[rule]; exists {
-					ruleConfig := config.Rules.Indent[rule]
-					ruleConfig.Disabled = true
-					config.Rules.Indent[rule] = ruleConfig
-				} else {
-					return fmt.Errorf("unknown rule: %s", rule)
+			if opts.diff && opts.stdout {
+				return fmt.Errorf("--diff and --stdout are mutually exclusive")
+			}
+			if !slices.Contains(outputFormats, opts.outputFormat) {
+				return fmt.Errorf("unknown output format: %s (supported: %s)", opts.outputFormat, strings.Join(outputFormats, ", "))
+			}
+			if opts.outputFormat != formatText && (opts.stdout || opts.diff) {
+				return fmt.Errorf("--output-format=%s can't be combined with --stdout or --diff", opts.outputFormat)
+			}
+			opts.color = isTerminal(os.Stdout)
+			var err error
+			if opts.lines, err = parseLineRanges(lines); err != nil {
+				return err
+			}
+			if verify != "" {
+				if opts.verifier, err = newRenderVerifier(verify, valuesFiles); err != nil {
+					return err
 				}
+			} else if len(valuesFiles) > 0 {
+				return fmt.Errorf("--values requires --verify")
 			}
 
-			for _, rule := range enableRules {
-				if _, exists := config.Rules.Indent[rule]; exists {
-					ruleConfig := config.Rules.Indent[rule]
-					ruleConfig.Disabled = false
-					config.Rules.Indent[rule] = ruleConfig
-				} else {
-					return fmt.Errorf("unknown rule: %s", rule)
-				}
+			// Every file gets the config found from its directory, with the
+			// rule overrides from flags applied
+			configs, err := loadConfig(configPath, noConfig, rules.apply)
+			if err != nil {
+				return err
+			}
+			// Report an invalid config or override before touching any file
+			if _, err := configs.forDir("."); err != nil {
+				return err
 			}
 
 			// Check if stdin is being piped
 			stat, _ := os.Stdin.Stat()
 			stdinPiped := (stat.Mode() & os.ModeCharDevice) == 0
 
+			// Only changed files of the given charts (the current directory by default)
+			if changedSince != "" || staged {
+				switch {
+				case changedSince != "" && staged:
+					return fmt.Errorf("--changed-since and --staged are mutually exclusive")
+				case files:
+					return fmt.Errorf("--changed-since and --staged can't be combined with --files")
+				case len(opts.lines) > 0:
+					return fmt.Errorf("--lines requires --files or stdin")
+				case strings.HasPrefix(changedSince, "-"):
+					return fmt.Errorf("invalid git ref: %s", changedSince)
+				}
+				changed, err := gitChangedFiles(changedSince, staged)
+				if err != nil {
+					return err
+				}
+				if len(args) == 0 {
+					args = []string{"."}
+				}
+				chartFiles, err := collectChartFiles(args, configs)
+				if err != nil {
+					return err
+				}
+				opts.stdout = false
+				exitCode := process(newFileFilter(configs, opts.verbose).filter(filterChanged(chartFiles, changed)), opts, configs)
+				if exitCode != 0 {
+					os.Exit(exitCode)
+				}
+				return nil
+			}
+
 			// If --files flag is used, process the provided files
 			if files {
 				if len(args) == 0 {
 					// --files with no args means read filenames from stdin (pre-commit style)
 					if stdinPiped {
-						return processFilesFromStdin(config, stdout, check)
+						return processFilesFromStdin(configs, opts)
 					}
 					return fmt.Errorf("--files requires at least one file argument")
 				}
 				// --files with args means process those files
-				exitCode := process(args, stdout, check, config)
+				exitCode := process(newFileFilter(configs, opts.verbose).filter(args), opts, configs)
 				if exitCode != 0 {
 					os.Exit(exitCode)
 				}
@@ -135,24 +150,23 @@ func run() int {
 
 			// If stdin is piped and no --files flag, process stdin as content
 			if stdinPiped && len(args) == 0 {
-				return processStdin(config, check)
+				return processStdin(configs, opts)
 			}
 
 			// Chart mode
-			if len(args) != 1 {
-				return fmt.Errorf("chart mode requires exactly one chart path")
+			if len(args) == 0 {
+				return fmt.Errorf("chart mode requires at least one chart path")
 			}
-
-			root := filepath.Join(args[0], "templates")
-			if _, err := os.Stat(root); err != nil {
-				return err
+			if len(opts.lines) > 0 {
+				return fmt.Errorf("--lines requires --files or stdin")
 			}
 
-			chartFiles, err := collectFiles(root, config)
+			chartFiles, err := collectChartFiles(args, configs)
 			if err != nil {
 				return err
 			}
-			exitCode := process(chartFiles, false, check, config)
+			opts.stdout = false
+			exitCode := process(newFileFilter(configs, opts.verbose).filter(chartFiles), opts, configs)
 			if exitCode != 0 {
 				os.Exit(exitCode)
 			}
@@ -161,10 +175,74 @@ func run() int {
 	}
 
 	rootCmd.Flags().BoolVar(&files, "files", false, "Process specific files")
-	rootCmd.Flags().BoolVar(&stdout, "stdout", false, "Output to stdout")
-	rootCmd.Flags().BoolVar(&check, "check", false, "Check formatting without modifying files (exit 1 if unformatted)")
-	rootCmd.Flags().StringSliceVar(&disableRules, "disable-indent", []string{}, "Disable specific indent rules (e.g., --disable-indent=printf,include)")
-	rootCmd.Flags().StringSliceVar(&enableRules, "enable-indent", []string{}, "Enable specific indent rules (e.g., --enable-indent=printf,include)")
+	rootCmd.Flags().BoolVar(&opts.stdout, "stdout", false, "Output to stdout")
+	rootCmd.Flags().BoolVar(&opts.check, "check", false, "Check formatting without modifying files (exit 1 if unformatted)")
+	rootCmd.Flags().BoolVar(&opts.diff, "diff", false, "Print a unified diff of formatting changes instead of modifying files")
+	rootCmd.Flags().IntVarP(&opts.jobs, "jobs", "j", runtime.GOMAXPROCS(0), "Number of files to process in parallel")
+	rootCmd.Flags().BoolVar(&opts.verbose, "verbose", false, "Report skipped files and trim markers changed by trim rules")
+	rootCmd.Flags().StringVar(&opts.outputFormat, "output-format", formatText, "Report format: "+strings.Join(outputFormats, "|"))
+	rootCmd.Flags().StringVar(&changedSince, "changed-since", "", "Only process chart files changed since a git ref (committed or not)")
+	rootCmd.Flags().BoolVar(&staged, "staged", false, "Only process chart files staged in git")
+	rootCmd.Flags().StringArrayVar(&lines, "lines", nil, "Only format lines start:end (1-based, inclusive; repeatable)")
+	rootCmd.Flags().StringVar(&verify, "verify", "", "Render changed files before and after formatting and refuse changes to the output: exact|whitespace")
+	rootCmd.Flags().Lookup("verify").NoOptDefVal = verifyExact
+	rootCmd.Flags().StringArrayVarP(&valuesFiles, "values", "f", nil, "Values file used by --verify over the chart's values.yaml (repeatable)")
+	// Rule flags change the config, so they apply to the subcommands too
+	rootCmd.PersistentFlags().StringSliceVar(&rules.disableIndent, "disable-indent", []string{}, "Disable specific indent rules (e.g., --disable-indent=printf,include)")
+	rootCmd.PersistentFlags().StringSliceVar(&rules.enableIndent, "enable-indent", []string{}, "Enable specific indent rules, for any function (e.g., --enable-indent=printf,include,required)")
+	rootCmd.PersistentFlags().StringSliceVar(&rules.disableSpacing, "disable-spacing", []string{}, "Disable specific spacing rules (e.g., --disable-spacing=pipe)")
+	rootCmd.PersistentFlags().StringSliceVar(&rules.enableSpacing, "enable-spacing", []string{}, "Enable specific spacing rules (e.g., --enable-spacing=delimiters,assignment,pipe)")
+	rootCmd.PersistentFlags().StringSliceVar(&rules.disableTrim, "disable-trim", []string{}, "Disable specific trim rules (e.g., --disable-trim=drop_right)")
+	rootCmd.PersistentFlags().StringSliceVar(&rules.enableTrim, "enable-trim", []string{}, "Enable specific trim rules (e.g., --enable-trim=add_left,drop_right)")
+
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Use this config file for every template instead of looking for one (default $"+configEnv+")")
+	rootCmd.PersistentFlags().BoolVar(&noConfig, "no-config", false, "Ignore config files and use the defaults")
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "lsp",
+		Short: "Run a Language Server Protocol server over stdio",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configs, err := loadConfig(configPath, noConfig, rules.apply)
+			if err != nil {
+				return err
+			}
+			if _, err := configs.forDir("."); err != nil {
+				return err
+			}
+			return newLSPServer(os.Stdin, os.Stdout, configs).serve()
+		},
+	})
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the config file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return writeConfigSchema()
+		},
+	})
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "show [path]",
+		Short: "Print the effective config of a file or directory and where each value comes from",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configs, err := loadConfig(configPath, noConfig, rules.apply)
+			if err != nil {
+				return err
+			}
+			path := "."
+			if len(args) > 0 {
+				path = args[0]
+			}
+			return writeConfigShow(os.Stdout, configs, path)
+		},
+	})
+	rootCmd.AddCommand(configCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -173,7 +251,65 @@ func run() int {
 	return 0
 }
 
-func processFilesFromStdin(config *Config, stdout bool, check bool) error {
+// ruleFlags are the command-line flags enabling and disabling rules.
+type ruleFlags struct {
+	disableIndent, enableIndent   []string
+	disableSpacing, enableSpacing []string
+	disableTrim, enableTrim       []string
+}
+
+// apply sets the rules named by the flags in config. Only --enable-indent
+// accepts names of rules that don't exist yet.
+func (f *ruleFlags) apply(config *helmfmt.Config) error {
+	if err := setRulesDisabled(config.Rules.Indent, f.disableIndent, true, false); err != nil {
+		return err
+	}
+	if err := setRulesDisabled(config.Rules.Indent, f.enableIndent, false, true); err != nil {
+		return err
+	}
+	if err := setRulesDisabled(config.Rules.Spacing, f.disableSpacing, true, false); err != nil {
+		return err
+	}
+	if err := setRulesDisabled(config.Rules.Spacing, f.enableSpacing, false, false); err != nil {
+		return err
+	}
+	if err := setRulesDisabled(config.Rules.Trim, f.disableTrim, true, false); err != nil {
+		return err
+	}
+	return setRulesDisabled(config.Rules.Trim, f.enableTrim, false, false)
+}
+
+// setRulesDisabled sets the disabled state of the named rules in a rule family.
+// Names the family does not define are rejected, unless open is set: enabling
+// an indent rule may define it for any function.
+func setRulesDisabled(rules map[string]helmfmt.RuleConfig, names []string, disabled, open bool) error {
+	for _, name := range names {
+		ruleConfig, exists := rules[name]
+		if !exists && !open {
+			return fmt.Errorf("unknown rule: %s", name)
+		}
+		ruleConfig.Disabled = disabled
+		rules[name] = ruleConfig
+	}
+	return nil
+}
+
+// parseLineRanges parses --lines values of the form start:end.
+func parseLineRanges(values []string) ([]helmfmt.LineRange, error) {
+	var ranges []helmfmt.LineRange
+	for _, v := range values {
+		startStr, endStr, ok := strings.Cut(v, ":")
+		start, err1 := strconv.Atoi(startStr)
+		end, err2 := strconv.Atoi(endStr)
+		if !ok || err1 != nil || err2 != nil || start < 1 || end < start {
+			return nil, fmt.Errorf("invalid --lines %q: expected start:end with 1 <= start <= end", v)
+		}
+		ranges = append(ranges, helmfmt.LineRange{Start: start, End: end})
+	}
+	return ranges, nil
+}
+
+func processFilesFromStdin(configs *configResolver, opts runOptions) error {
 	// Read filenames from stdin (one per line)
 	input, err := io.ReadAll(os.Stdin)
 	if err != nil {
@@ -193,36 +329,64 @@ func processFilesFromStdin(config *Config, stdout bool, check bool) error {
 		return fmt.Errorf("no files provided via stdin")
 	}
 
-	exitCode := process(filenames, stdout, check, config)
+	exitCode := process(newFileFilter(configs, opts.verbose).filter(filenames), opts, configs)
 	if exitCode != 0 {
 		os.Exit(exitCode)
 	}
 	return nil
 }
 
-func processStdin(config *Config, check bool) error {
+func processStdin(configs *configResolver, opts runOptions) error {
 	// Read all input from stdin
 	input, err := io.ReadAll(os.Stdin)
 	if err != nil {
 		return fmt.Errorf("error reading from stdin: %w", err)
 	}
 
+	// Stdin is formatted with the config of the current directory
+	config, err := configs.forDir(".")
+	if err != nil {
+		return err
+	}
+
 	orig := string(input)
 
-	// Validate syntax
-	if err := validateTemplateSyntax(orig); err != nil {
+	if opts.outputFormat != formatText {
+		if !opts.check {
+			return fmt.Errorf("--output-format=%s requires --check when formatting stdin", opts.outputFormat)
+		}
+		if exitCode := writeReport([]fileResult{formatResult("<stdin>", orig, opts, config)}, opts); exitCode != 0 {
+			os.Exit(exitCode)
+		}
+		return nil
+	}
+
+	formatted, notes, err := formatSource(orig, opts, config, "<stdin>")
+	if err != nil {
 		return fmt.Errorf("invalid syntax: %w", err)
 	}
+	writeNotes("<stdin>", notes, opts)
 
-	formatted := ensureTrailingNewline(formatIndentation(orig, config, "<stdin>"))
+	unchanged := helmfmt.IsFormatted([]byte(orig), []byte(formatted))
+	if opts.verifier != nil && !unchanged {
+		if err := opts.verifier.verify("<stdin>", orig, formatted); err != nil {
+			return err
+		}
+	}
+	if opts.diff && !unchanged {
+		fmt.Print(unifiedDiff("<stdin>", orig, formatted, opts.color))
+	}
 
-	if check {
-		if formatted != orig && formatted != orig+"\n" {
+	if opts.check {
+		if !unchanged {
 			fmt.Fprintln(os.Stderr, "[UNFORMATTED] <stdin>")
 			os.Exit(1)
 		}
 		return nil
 	}
+	if opts.diff {
+		return nil
+	}
 
 	// Format and output to stdout
 	fmt.Print(formatted)
@@ -230,7 +394,7 @@ func processStdin(config *Config, check bool) error {
 	return nil
 }
 
-func collectFiles(root string, config *Config) ([]string, error) {
+func collectFiles(root string, config *helmfmt.Config) ([]string, error) {
 	var out []string
 	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -246,81 +410,109 @@ func collectFiles(root string, config *Config) ([]string, error) {
 	return out, err
 }
 
-func process(files []string, stdout bool, check bool, config *Config) int {
-	var total, updated, failed, unformatted int
-
-	for _, file := range files {
-		total++
-
-		b, err := os.ReadFile(file)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "[ERROR]  %s: %v\n", file, err)
-			failed++
-			continue
-		}
-		orig := string(b)
-
-		if err := validateTemplateSyntax(orig); err != nil {
-			fmt.Fprintf(os.Stderr, "[ERROR]  Invalid syntax %s: %v\n", file, err)
-			failed++
-			continue
-		}
-
-		formatted := ensureTrailingNewline(formatIndentation(orig, config, file))
+func process(files []string, opts runOptions, configs *configResolver) int {
+	return writeReport(processFiles(files, opts, configs), opts)
+}
 
-		if check {
-			if formatted != orig && formatted != orig+"\n" {
-				fmt.Fprintf(os.Stderr, "[UNFORMATTED] %s\n", file)
-				unformatted++
+// processFiles processes files on up to opts.jobs concurrent workers. Results
+// are returned in the order of files, so output stays deterministic.
+func processFiles(files []string, opts runOptions, configs *configResolver) []fileResult {
+	results := make([]fileResult, len(files))
+	jobs := min(max(opts.jobs, 1), len(files))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = processFile(files[i], opts, configs)
 			}
-			continue
-		}
+		}()
+	}
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 
-		if stdout {
-			fmt.Print(formatted)
-			continue
-		}
+	return results
+}
 
-		// In-place mode: don't write if the only change is a trailing newline
-		if formatted == orig || formatted == orig+"\n" {
-			continue
-		}
+// processFile formats a single file and, in in-place mode, writes it back.
+func processFile(file string, opts runOptions, configs *configResolver) fileResult {
+	config, err := configs.forFile(file)
+	if err != nil {
+		return fileResult{File: file, Status: statusError, Error: &fileError{Kind: errorConfig, Message: err.Error()}}
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return fileResult{File: file, Status: statusError, Error: &fileError{Kind: errorIO, Message: err.Error()}}
+	}
 
-		info, err := os.Stat(file)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "[ERROR]  %s: %v\n", file, err)
-			failed++
-			continue
-		}
-		if err := os.WriteFile(file, []byte(formatted), info.Mode()); err != nil {
-			fmt.Fprintf(os.Stderr, "[ERROR]  %s: %v\n", file, err)
-			failed++
-			continue
-		}
+	res := formatResult(file, string(b), opts, config)
+	if res.Status != statusUnformatted || opts.check || opts.diff || opts.stdout {
+		return res
+	}
 
-		fmt.Printf("[UPDATED] %s\n", file)
-		updated++
+	info, err := os.Stat(file)
+	if err == nil {
+		err = os.WriteFile(file, []byte(res.formatted), info.Mode())
 	}
+	if err != nil {
+		res.Status, res.Error = statusError, &fileError{Kind: errorIO, Message: err.Error()}
+		return res
+	}
+	res.Status = statusUpdated
+	return res
+}
 
-	if check {
-		if unformatted > 0 || failed > 0 {
-			fmt.Fprintf(os.Stderr, "\n%d file(s) need formatting, %d error(s)\n", unformatted, failed)
-			return 1
-		}
-		fmt.Printf("All %d file(s) are properly formatted\n", total)
-		return 0
+// formatResult formats the content orig of the file called name and describes
+// the outcome, without touching the file system.
+func formatResult(name, orig string, opts runOptions, config *helmfmt.Config) fileResult {
+	res := fileResult{File: name}
+	formatted, notes, err := formatSource(orig, opts, config, name)
+	if err != nil {
+		res.Status, res.Error = statusError, syntaxError(err)
+		return res
 	}
+	res.formatted = formatted
+	res.Notes = notes
 
-	if !stdout {
-		fmt.Printf("\nProcessed: %d files, Updated: %d, Errors: %d\n", total, updated, failed)
+	// A missing trailing newline alone doesn't make a file unformatted
+	if helmfmt.IsFormatted([]byte(orig), []byte(formatted)) {
+		res.Status = statusFormatted
+		return res
 	}
-	if failed > 0 {
-		return 1
+	if opts.verifier != nil {
+		if err := opts.verifier.verify(name, orig, formatted); err != nil {
+			res.Status, res.Error = statusError, &fileError{Kind: errorRender, Message: err.Error()}
+			return res
+		}
 	}
-	return 0
+	res.Status = statusUnformatted
+	res.Changes = changedRanges(orig, formatted)
+	if opts.diff {
+		res.diff = unifiedDiff(name, orig, formatted, opts.color)
+	}
+	return res
+}
+
+// formatSource formats orig, only rewriting the lines selected with --lines
+// if any.
+func formatSource(orig string, opts runOptions, config *helmfmt.Config, name string) (string, []helmfmt.Note, error) {
+	formatted, notes, err := helmfmt.FormatWithNotes([]byte(orig), helmfmt.Options{Config: config, Filename: name, Lines: opts.lines})
+	return string(formatted), notes, err
+}
+
+// isTerminal reports whether f is connected to a terminal.
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && (stat.Mode()&os.ModeCharDevice) != 0
 }
 
-func wanted(path string, config *Config) bool {
+func wanted(path string, config *helmfmt.Config) bool {
 	ext := strings.ToLower(filepath.Ext(path))
 	for _, validExt := range config.Extensions {
 		if ext == validExt {
@@ -329,10 +521,3 @@ func wanted(path string, config *Config) bool {
 	}
 	return false
 }
-
-func ensureTrailingNewline(s string) string {
-	if strings.HasSuffix(s, "\n") {
-		return s
-	}
-	return s + "\n"
-}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+)
+
+func TestCheckLines(t *testing.T) {
+	src := "{{- if .X }}\n{{- $a := 1 }}\n  {{- $b := 2 }}\n{{- end }}\n"
+	opts := runOptions{check: true}
+
+	opts.lines = []helmfmt.LineRange{{Start: 3, End: 4}}
+	if res := formatResult("f.yaml", src, opts, helmfmt.DefaultConfig()); res.Status != statusFormatted {
+		t.Errorf("lines 3-4: expected %s, got %s", statusFormatted, res.Status)
+	}
+
+	opts.lines = []helmfmt.LineRange{{Start: 1, End: 2}}
+	res := formatResult("f.yaml", src, opts, helmfmt.DefaultConfig())
+	if res.Status != statusUnformatted || len(res.Changes) != 1 || res.Changes[0] != (helmfmt.LineRange{Start: 2, End: 2}) {
+		t.Errorf("lines 1-2: expected line 2 unformatted, got %s %v", res.Status, res.Changes)
+	}
+}
+
+func TestParseLineRanges(t *testing.T) {
+	got, err := parseLineRanges([]string{"10:42", "3:3"})
+	if err != nil || len(got) != 2 || got[0] != (helmfmt.LineRange{Start: 10, End: 42}) || got[1] != (helmfmt.LineRange{Start: 3, End: 3}) {
+		t.Errorf("unexpected result %v, %v", got, err)
+	}
+	for _, invalid := range []string{"10", "0:3", "5:2", "a:b"} {
+		if _, err := parseLineRanges([]string{invalid}); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestRuleFlags(t *testing.T) {
+	config := helmfmt.DefaultConfig()
+	flags := &ruleFlags{enableIndent: []string{"required"}, disableIndent: []string{"include"}}
+	if err := flags.apply(config); err != nil {
+		t.Fatal(err)
+	}
+	if rule, ok := config.Rules.Indent["required"]; !ok || rule.Disabled {
+		t.Errorf("expected --enable-indent to add a rule, got %+v", config.Rules.Indent)
+	}
+
+	for _, flags := range []*ruleFlags{
+		{disableIndent: []string{"iff"}},
+		{disableSpacing: []string{"pipes"}},
+		{enableTrim: []string{"add"}},
+	} {
+		err := flags.apply(helmfmt.DefaultConfig())
+		if err == nil || !strings.HasPrefix(err.Error(), "unknown rule: ") {
+			t.Errorf("%+v: expected an unknown rule error, got %v", flags, err)
+		}
+	}
+}
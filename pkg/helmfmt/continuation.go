@@ -0,0 +1,159 @@
+package helmfmt
+
+import "strings"
+
+// continuationMode returns the effective Config.ContinuationIndent.
+func (c *Config) continuationMode() string {
+	switch {
+	case c.ContinuationIndent != "":
+		return c.ContinuationIndent
+	case c.MaxLineLength > 0:
+		return ContinuationBlock
+	default:
+		return ContinuationFlatten
+	}
+}
+
+// layoutContinuation reindents the continuation lines of a multi-line action
+// as config.ContinuationIndent says. lines are the lines of the action, the
+// first one already reindented to indent with the action starting at byte
+// pos. Blank lines and lines inside raw strings are kept as they are.
+func layoutContinuation(lines []string, pos int, indent string, config *Config) {
+	mode := config.continuationMode()
+	start := pos + len(leftDelim)
+	if hasLeftTrimMarker(lines[0][start:]) {
+		start++
+	}
+	col := config.width(lines[0][:start])
+	s := &continuationScanner{tabWidth: config.tabWidth(), frames: []continuationFrame{{open: -1, cmd: -1, arg: -1}}}
+	s.scan(lines[0][start:], col)
+
+	for j := 1; j < len(lines); j++ {
+		trimmed := strings.TrimLeft(lines[j], " \t")
+		if trimmed != "" && !s.raw {
+			lines[j] = s.indent(mode, trimmed, indent, config) + trimmed
+		}
+		s.scan(lines[j], 0)
+	}
+}
+
+// continuationScanner follows the parentheses of a multi-line action line by
+// line, remembering where the pipeline and the arguments of each open call
+// start.
+type continuationScanner struct {
+	tabWidth int
+	raw      bool // inside a raw string spanning lines
+	frames   []continuationFrame
+}
+
+// continuationFrame is the action itself or an open parenthesis in it.
+type continuationFrame struct {
+	open   int // column of the "(", -1 for the action
+	cmd    int // column of the first command of the pipeline, -1 if none yet
+	arg    int // column of the first argument of the current command, -1 if none yet
+	words  int // words of the current command read so far
+	inWord bool
+	word   []byte // the word being read
+}
+
+// indent returns the indentation of a continuation line starting with
+// trimmed, given the state at the end of the line before and the indentation
+// of the action.
+func (s *continuationScanner) indent(mode, trimmed, indent string, config *Config) string {
+	closers := len(trimmed) - len(strings.TrimLeft(trimmed, ")"))
+	depth := max(len(s.frames)-1-closers, 0)
+	switch mode {
+	case ContinuationBlock:
+		return indent + config.indentOf(depth+1)
+	case ContinuationAlign:
+		if closers > 0 && len(s.frames) > 1 {
+			return config.alignTo(indent, s.frames[max(len(s.frames)-closers, 1)].open)
+		}
+		// A line starting a command of the pipeline lines up with its first
+		// command, not with the arguments of the command before
+		f := &s.frames[len(s.frames)-1]
+		switch {
+		case f.cmd >= 0 && (strings.HasPrefix(trimmed, "|") || f.words == 0):
+			return config.alignTo(indent, f.cmd)
+		case f.arg >= 0:
+			return config.alignTo(indent, f.arg)
+		case f.open >= 0:
+			return config.alignTo(indent, f.open+1)
+		default:
+			return indent + config.indentOf(1)
+		}
+	default:
+		return indent
+	}
+}
+
+// scan reads line, whose first character is at column col. Tabs advance to
+// the next tab stop.
+func (s *continuationScanner) scan(line string, col int) {
+	for i := 0; i < len(line); {
+		c := line[i]
+		f := &s.frames[len(s.frames)-1]
+		n := 1
+		switch {
+		case s.raw:
+			if c == '`' {
+				s.raw = false
+			}
+		case c == '`':
+			s.startWord(f, col)
+			s.raw = true
+		case c == '"' || c == '\'':
+			s.startWord(f, col)
+			n = skipQuoted(line, i) - i
+		case c == '(':
+			s.startWord(f, col)
+			s.frames = append(s.frames, continuationFrame{open: col, cmd: -1, arg: -1})
+		case c == ')':
+			s.endWord(f)
+			if len(s.frames) > 1 {
+				s.frames = s.frames[:len(s.frames)-1]
+			}
+		case isSpace(c):
+			s.endWord(f)
+		case c == '|':
+			s.endWord(f)
+			f.words, f.arg = 0, -1
+		default:
+			s.startWord(f, col)
+			f.word = append(f.word, c)
+		}
+		i += n
+		col = advance(col, line[i-n:i], s.tabWidth)
+	}
+}
+
+func (s *continuationScanner) startWord(f *continuationFrame, col int) {
+	if f.inWord {
+		return
+	}
+	f.inWord = true
+	f.word = f.word[:0]
+	switch f.words++; {
+	case f.words == 1 && f.cmd < 0:
+		f.cmd = col
+	case f.words == 2:
+		f.arg = col
+	}
+}
+
+// endWord ends the word being read. Declarations and control keywords don't
+// count as the function of the command.
+func (s *continuationScanner) endWord(f *continuationFrame) {
+	if !f.inWord {
+		return
+	}
+	f.inWord = false
+	switch string(f.word) {
+	case ":=", "=":
+		f.words, f.cmd, f.arg = 0, -1, -1
+	case "if", "with", "range", "else":
+		if f.words == 1 && f.open < 0 {
+			f.words, f.cmd = 0, -1
+		}
+	}
+}
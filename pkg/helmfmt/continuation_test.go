@@ -0,0 +1,126 @@
+package helmfmt
+
+import "testing"
+
+func TestContinuationIndent(t *testing.T) {
+	src := `{{- if .Values.enabled }}
+{{- $labels := merge (dict "a" 1)
+(dict "b" (list 1
+2)) }}
+labels:
+{{- include "app.labels" (dict
+"custom" $labels
+"raw" ` + "`x\n  y`" + `
+) | nindent 2 }}
+{{- end }}
+`
+	tests := []struct {
+		mode     string
+		expected string
+	}{
+		{
+			mode: ContinuationFlatten,
+			expected: `{{- if .Values.enabled }}
+  {{- $labels := merge (dict "a" 1)
+  (dict "b" (list 1
+  2)) }}
+labels:
+{{- include "app.labels" (dict
+"custom" $labels
+"raw" ` + "`x\n  y`" + `
+) | nindent 2 }}
+{{- end }}
+`,
+		},
+		{
+			mode: ContinuationBlock,
+			expected: `{{- if .Values.enabled }}
+  {{- $labels := merge (dict "a" 1)
+    (dict "b" (list 1
+        2)) }}
+labels:
+{{- include "app.labels" (dict
+    "custom" $labels
+    "raw" ` + "`x\n  y`" + `
+  ) | nindent 2 }}
+{{- end }}
+`,
+		},
+		{
+			mode: ContinuationAlign,
+			expected: `{{- if .Values.enabled }}
+  {{- $labels := merge (dict "a" 1)
+                       (dict "b" (list 1
+                                       2)) }}
+labels:
+{{- include "app.labels" (dict
+                          "custom" $labels
+                          "raw" ` + "`x\n  y`" + `
+                         ) | nindent 2 }}
+{{- end }}
+`,
+		},
+	}
+
+	values := map[string]interface{}{"enabled": true}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			config := DefaultConfig()
+			config.ContinuationIndent = tt.mode
+			got, err := Format([]byte(src), Options{Config: config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+			if err := Verify("t.yaml", []byte(src), got, VerifyOptions{Values: values}); err != nil {
+				t.Error(err)
+			}
+			if again, err := Format(got, Options{Config: config}); err != nil || string(again) != string(got) {
+				t.Errorf("second pass: got %q, %v", again, err)
+			}
+		})
+	}
+
+	t.Run("aligned pipeline", func(t *testing.T) {
+		src := `{{- if .Values.enabled }}
+{{- $name := printf "%s-%s" .Release.Name "app"
+| trunc 63
+| trimSuffix "-"
+| lower }}
+{{- $label := .Values.name | default $name
+| lower |
+quote }}
+{{- end }}
+`
+		expected := `{{- if .Values.enabled }}
+  {{- $name := printf "%s-%s" .Release.Name "app"
+               | trunc 63
+               | trimSuffix "-"
+               | lower }}
+  {{- $label := .Values.name | default $name
+                | lower |
+                quote }}
+{{- end }}
+`
+		config := DefaultConfig()
+		config.ContinuationIndent = ContinuationAlign
+		got, err := Format([]byte(src), Options{Config: config})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+		}
+		if again, err := Format(got, Options{Config: config}); err != nil || string(again) != string(got) {
+			t.Errorf("second pass: got %q, %v", again, err)
+		}
+	})
+
+	config := DefaultConfig()
+	config.ContinuationIndent = "deep"
+	if _, err := Format([]byte(src), Options{Config: config}); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+}
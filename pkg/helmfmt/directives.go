@@ -0,0 +1,132 @@
+package helmfmt
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Directive comments control formatting of parts of a template:
+//
+//	{{/* helmfmt: off */}} ... {{/* helmfmt: on */}}  keep the lines in between verbatim
+//	{{/* helmfmt: ignore-next */}}                     keep the next non-blank line verbatim
+//	{{/* helmfmt: disable=include,printf */}}          disable rules until the enclosing block ends
+//	{{/* helmfmt: enable=include */}}                  enable rules until the enclosing block ends
+//
+// Preserved lines still count toward depth tracking, so the lines after them
+// are indented as if they were formatted.
+var directiveRe = regexp.MustCompile(`^\s*helmfmt:\s*(off|on|ignore-next|disable|enable)\s*(?:=\s*([\w\s,-]*?))?\s*$`)
+
+// directives holds the effect of the directive comments of a template.
+type directives struct {
+	preserved []bool            // per line: keep the line byte-for-byte
+	rules     []map[string]bool // per token: rules toggled by directives in scope (true = disabled)
+}
+
+// directiveScope is a disable/enable directive that lasts until the block
+// open at its depth ends.
+type directiveScope struct {
+	depth int
+	rules map[string]bool
+}
+
+// analyzeDirectives finds the directive comments among tokens and computes
+// which lines are preserved and which rules are toggled for every token.
+func analyzeDirectives(src string, tokens []token, starts []int) *directives {
+	d := &directives{
+		preserved: make([]bool, len(starts)),
+		rules:     make([]map[string]bool, len(tokens)),
+	}
+
+	var scopes []directiveScope
+	var current map[string]bool
+	depth := 0
+	offFrom := -1
+
+	for k, tok := range tokens {
+		if tok.typ == tokComment {
+			if m := directiveRe.FindStringSubmatch(tok.body); m != nil {
+				line := lineIndex(starts, tok.end-1)
+				switch m[1] {
+				case "off":
+					if offFrom < 0 {
+						offFrom = line + 1
+					}
+				case "on":
+					if offFrom >= 0 {
+						d.preserve(offFrom, lineIndex(starts, tok.pos)-1)
+						offFrom = -1
+					}
+				case "ignore-next":
+					d.preserve(nextNonBlankSpan(src, tokens, starts, line+1))
+				case "disable", "enable":
+					rules := make(map[string]bool, len(current))
+					for name, disabled := range current {
+						rules[name] = disabled
+					}
+					for _, name := range strings.Split(m[2], ",") {
+						if name = strings.TrimSpace(name); name != "" {
+							rules[name] = m[1] == "disable"
+						}
+					}
+					scopes = append(scopes, directiveScope{depth: depth, rules: rules})
+					current = rules
+				}
+			}
+		}
+
+		d.rules[k] = current
+		depth = nextDepth(depth, tok)
+
+		// Scopes end with the block that was open where they started
+		for len(scopes) > 0 && depth < scopes[len(scopes)-1].depth {
+			scopes = scopes[:len(scopes)-1]
+			current = nil
+			if len(scopes) > 0 {
+				current = scopes[len(scopes)-1].rules
+			}
+		}
+	}
+
+	if offFrom >= 0 {
+		d.preserve(offFrom, len(starts)-1)
+	}
+	return d
+}
+
+// preserve marks lines from..to as preserved. An empty range is a no-op.
+func (d *directives) preserve(from, to int) {
+	for i := max(from, 0); i <= to && i < len(d.preserved); i++ {
+		d.preserved[i] = true
+	}
+}
+
+// nextNonBlankSpan returns the first non-blank line at or after line from and
+// the last line of the tags starting on it, or -1, -1 if there is none.
+func nextNonBlankSpan(src string, tokens []token, starts []int, from int) (int, int) {
+	for i := from; i < len(starts); i++ {
+		end := len(src)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		if strings.TrimSpace(src[starts[i]:end]) == "" {
+			continue
+		}
+		to := i
+		for _, tok := range tokens {
+			if tok.typ != tokText && tok.pos >= starts[i] && tok.pos < end {
+				to = max(to, lineIndex(starts, tok.end-1))
+			}
+		}
+		return i, to
+	}
+	return -1, -1
+}
+
+// ruleDisabled reports whether the rule is disabled for tokens[k], taking
+// directives in scope into account before the configured state.
+func (d *directives) ruleDisabled(k int, name string, configured bool) bool {
+	if disabled, ok := d.rules[k][name]; ok {
+		return disabled
+	}
+	return configured
+}
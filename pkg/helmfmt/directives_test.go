@@ -0,0 +1,44 @@
+package helmfmt
+
+import "testing"
+
+func TestFormatDirectives(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name:     "off without on lasts until end of file",
+			src:      "{{- if .X }}\n{{/* helmfmt: off */}}\n{{- $a := 1 }}\n{{- end }}\n",
+			expected: "{{- if .X }}\n  {{/* helmfmt: off */}}\n{{- $a := 1 }}\n{{- end }}\n",
+		},
+		{
+			name:     "enable scoped to block",
+			src:      "{{- if .X }}\n{{/* helmfmt: enable=toYaml */}}\n{{ toYaml .Y }}\n{{- end }}\n{{- if .X }}\n{{ toYaml .Y }}\n{{- end }}\n",
+			expected: "{{- if .X }}\n  {{/* helmfmt: enable=toYaml */}}\n  {{ toYaml .Y }}\n{{- end }}\n{{- if .X }}\n{{ toYaml .Y }}\n{{- end }}\n",
+		},
+		{
+			name:     "ignore-next keeps a multi-line tag",
+			src:      "{{- if .X }}\n{{/* helmfmt: ignore-next */}}\n{{- $a := list\n      1 2 }}\n{{- $b := 1 }}\n{{- end }}\n",
+			expected: "{{- if .X }}\n  {{/* helmfmt: ignore-next */}}\n{{- $a := list\n      1 2 }}\n  {{- $b := 1 }}\n{{- end }}\n",
+		},
+		{
+			name:     "not a directive",
+			src:      "{{- if .X }}\n{{/* helmfmt: offline */}}\n{{- $a := 1 }}\n{{- end }}\n",
+			expected: "{{- if .X }}\n  {{/* helmfmt: offline */}}\n  {{- $a := 1 }}\n{{- end }}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := formatTemplate(tt.src, DefaultConfig(), "f.yaml")
+			if err != nil {
+				t.Fatalf("formatTemplate: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("unexpected result\nExpected:\n%s\nGot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,578 @@
+package helmfmt
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Типы токенов для ясности, что мы нашли
+type tokenKind int
+
+const (
+	tokNone        tokenKind = iota
+	tokControlOpen           // if, range, with, define, block
+	tokElse                  // else/else if
+	tokEnd                   // end
+	tokVar                   // {{ $var ... }}
+	tokSimple                // include, fail, printf и другие простые функции
+)
+
+var (
+	// Паттерны для определения типов токенов
+	varRe = regexp.MustCompile(`^\s*\$\w+\s*:?=`)
+
+	// Для извлечения первого слова
+	firstWordRe = regexp.MustCompile(`^\s*(\w+)`)
+)
+
+// stub is a no-op variadic function that satisfies any template function
+// signature. It is never executed — only registered so template.Parse accepts
+// the function name.
+func stub(args ...interface{}) interface{} { return nil }
+
+// helmFuncMap returns a template.FuncMap containing stub registrations for
+// every sprig function (minus env/expandenv which Helm drops) plus Helm's own
+// additions. Only the presence of each name matters for parse-time syntax
+// validation; the stubs are never executed.
+//
+// The sprigStubNames slice is generated by `go generate` from the actual
+// sprig.TxtFuncMap(), so it stays in sync when sprig adds new functions.
+func helmFuncMap() template.FuncMap {
+	f := make(template.FuncMap, len(sprigStubNames)+10)
+	for _, name := range sprigStubNames {
+		f[name] = stub
+	}
+	// Helm-specific functions not in sprig
+	helmExtras := []string{
+		"include", "tpl", "required", "lookup",
+		"toToml", "fromToml", "toYaml", "toYamlPretty", "fromYaml", "fromYamlArray",
+		"fromJsonArray",
+	}
+	for _, name := range helmExtras {
+		f[name] = stub
+	}
+	return f
+}
+
+// validateTemplateSyntax validates the given template source string using
+// Helm function set. Returns a *SyntaxError if the template has invalid syntax.
+func validateTemplateSyntax(src string) error {
+	err := parseTemplate(src)
+	if err == nil {
+		return nil
+	}
+	line, column := syntaxErrorPosition(src, err)
+	return &SyntaxError{Line: line, Column: column, Err: err}
+}
+
+// parseTemplate parses src with the Helm function set.
+func parseTemplate(src string) error {
+	_, err := template.New("validation").Funcs(helmFuncMap()).Parse(src)
+	return err
+}
+
+// parseErrorLineRe extracts the line from parse errors such as
+// "template: validation:3: unexpected ...".
+var parseErrorLineRe = regexp.MustCompile(`^template: [^:]*:(\d+):`)
+
+// syntaxErrorPosition returns the line of a parse error of src, and its column
+// if the tag it comes from can be found, 0 otherwise. Parse errors only tell
+// the line, but the parser stops at the first error, so the tag is the one
+// ending the shortest prefix of src that fails the same way. The column is
+// then that of the item the message quotes, if the tag holds it, or that of
+// the tag.
+func syntaxErrorPosition(src string, err error) (int, int) {
+	m := parseErrorLineRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0, 0
+	}
+	line, _ := strconv.Atoi(m[1])
+
+	var tags []token
+	for _, tok := range lexTemplate(src) {
+		if tok.typ != tokText {
+			tags = append(tags, tok)
+		}
+	}
+	k := sort.Search(len(tags), func(k int) bool {
+		prefixErr := parseTemplate(src[:tags[k].end])
+		return prefixErr != nil && prefixErr.Error() == err.Error()
+	})
+	if k == len(tags) {
+		return line, 0
+	}
+	tag := tags[k]
+	offs := []int{tag.pos}
+	if q := quotedItemRe.FindString(err.Error()); q != "" {
+		if item, uerr := strconv.Unquote(q); uerr == nil && item != "" {
+			if x := strings.Index(src[tag.pos:tag.end], item); x >= 0 {
+				offs = []int{tag.pos + x, tag.pos}
+			}
+		}
+	}
+	for _, off := range offs {
+		if strings.Count(src[:off], "\n")+1 == line {
+			return line, off - strings.LastIndexByte(src[:off], '\n')
+		}
+	}
+	return line, 0
+}
+
+// quotedItemRe matches the first quoted item of a parse error message, as in
+// `function "bogus" not defined`.
+var quotedItemRe = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+// formatTemplate validates src and returns it fully formatted: spacing inside
+// actions first, then trim markers, then indentation.
+func formatTemplate(src string, config *Config, filePath string) (string, []Note, error) {
+	formatted := formatSpacing(src, config, filePath)
+	if err := validateTemplateSyntax(src); err != nil {
+		// A trim marker glued to its keyword ({{-if .X-}}) is a syntax error
+		// that the delimiters spacing rule repairs; accept the source if the
+		// repaired version is valid.
+		if formatted == src || validateTemplateSyntax(formatted) != nil {
+			return "", nil, err
+		}
+	}
+	formatted, notes := formatTrim(formatted, config, filePath)
+	formatted, indentNotes := formatIndentation(formatted, config, filePath)
+	return ensureTrailingNewline(formatted), sortNotes(append(notes, indentNotes...)), nil
+}
+
+// Главная функция выравнивания
+//
+// The source is lexed into text, action and comment tokens (see lexTemplate),
+// so nesting follows every tag in the file, wherever it sits on a line, and a
+// "}}" inside a string literal never ends a tag. Only lines that start with a
+// tag are reindented, and lines protected by helmfmt directives (see
+// analyzeDirectives) are kept verbatim.
+//
+// Reindenting a line whose leading whitespace reaches the rendered output is
+// handled as config.LeadingWhitespace says, with a note for each such line.
+func formatIndentation(src string, config *Config, filePath string) (string, []Note) {
+	tokens := lexTemplate(src)
+	applyParseTree(src, tokens)
+	lines := strings.Split(src, "\n")
+	starts := lineOffsets(lines)
+	dirs := analyzeDirectives(src, tokens, starts)
+	matchers, _ := compileIndentMatchers(config) // checked by Format
+	var notes []Note
+	if config.WarnTabs {
+		notes = tabNotes(tokens, lines, starts)
+	}
+	depth := 0
+
+	// reindent reports whether line i, starting with tokens[k], may get the
+	// indentation indent, and adds a trim marker to it if the config asks so.
+	// outputs tells whether the tag writes anything: such a tag can't be
+	// trimmed without gluing its output to the line before.
+	reindent := func(i, k int, indent string, outputs bool) bool {
+		if lines[i][:leadingWhitespace(lines[i])] == indent || !leadingWhitespaceLeaks(src, tokens, k) {
+			return true
+		}
+		switch {
+		case config.LeadingWhitespace == LeadingWhitespaceSkip:
+			notes = append(notes, Note{Line: i + 1, Rule: NoteLeadingWhitespace, Message: "left alone: no {{- trims its indentation, which would reach the rendered output"})
+			return false
+		case config.LeadingWhitespace == LeadingWhitespaceTrim && outputs:
+			notes = append(notes, Note{Line: i + 1, Rule: NoteLeadingWhitespace, Message: "left alone: no {{- trims its indentation, and adding one would glue the tag's output to the line before"})
+			return false
+		case config.LeadingWhitespace == LeadingWhitespaceTrim:
+			lines[i] = addLeftTrim(lines[i])
+			notes = append(notes, Note{Line: i + 1, Rule: NoteLeadingWhitespace, Message: "added {{- to keep its indentation out of the rendered output"})
+		case !leadingWhitespaceBlank(src, tokens, k):
+			// Only lines with output are worth a note: others render as a
+			// whitespace-only line either way
+			notes = append(notes, Note{Line: i + 1, Rule: NoteLeadingWhitespace, Message: "reindented, but no {{- trims its indentation: the rendered output changes"})
+		}
+		return true
+	}
+
+	// layout lays out the continuation lines of the action tokens[t], which
+	// starts line i after its indentation, up to the first preserved line.
+	layout := func(i, t int) {
+		tok := tokens[t]
+		last, endLine := i, lineIndex(starts, tok.end-1)
+		for last < endLine && !dirs.preserved[last+1] {
+			last++
+		}
+		// Line i may have been reindented, or given a trim marker, before the
+		// action
+		origLen := len(src) - starts[i]
+		if i+1 < len(starts) {
+			origLen = starts[i+1] - 1 - starts[i]
+		}
+		pos := tok.pos - starts[i] + len(lines[i]) - origLen
+		layoutContinuation(lines[i:last+1], pos, lines[i][:leadingWhitespace(lines[i])], config)
+	}
+
+	// keep leaves line i, starting with tokens[t], at its indentation. Unless
+	// they are flattened, continuation lines are laid out all the same: they
+	// are inside the action, so they never reach the rendered output.
+	keep := func(i, t int) {
+		if config.continuationMode() != ContinuationFlatten {
+			layout(i, t)
+		}
+	}
+
+	next := 0 // first token whose effect on depth has not been applied yet
+
+	for i := 0; i < len(lines); i++ {
+		// Apply nesting changes of every tag that started before this line
+		for next < len(tokens) && tokens[next].pos < starts[i] {
+			depth = nextDepth(depth, tokens[next])
+			next++
+		}
+
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || dirs.preserved[i] {
+			continue
+		}
+
+		t := tagAt(tokens, next, starts[i]+leadingWhitespace(lines[i]))
+		if t < 0 {
+			continue
+		}
+
+		// standalone comment block => indent with current depth, don't attach to next token
+		if tokens[t].typ == tokComment && blankUntilEOL(src, tokens[t].end) {
+			cEnd := lineIndex(starts, tokens[t].end-1)
+			newIndent := config.indentOf(depth)
+			if !reindent(i, t, newIndent, false) {
+				i = cEnd
+				continue
+			}
+			// Reindent the opening line and shift the remaining lines by the same
+			// amount, preserving any relative indentation of the comment body
+			// (e.g. YAML examples inside the comment). The amount is in columns,
+			// tabs expanded.
+			delta := config.width(newIndent) - config.width(lines[i][:leadingWhitespace(lines[i])])
+			lines[i] = newIndent + strings.TrimLeft(lines[i], " \t")
+			for j := i + 1; j <= cEnd && !dirs.preserved[j]; j++ {
+				lines[j] = shiftIndent(lines[j], delta, config)
+			}
+			i = cEnd
+			continue
+		}
+
+		// Leading comments attach to the tag that follows them on the same line
+		first := t
+		for t >= 0 && tokens[t].typ == tokComment {
+			t = followingTag(src, tokens, t)
+		}
+		if t < 0 {
+			continue
+		}
+
+		tok := tokens[t]
+		endLine := lineIndex(starts, tok.end-1)
+		kind := tok.kind
+		ruleName := ""
+		switch kind {
+		case tokNone:
+			ruleName = indentRule(config, matchers, tok)
+			if ruleName == "" {
+				// A keyword without a rule is only indented if a directive enables it
+				if dirs.ruleDisabled(t, tok.keyword, true) && !yamlSafe(config, dirs, t, tok.keyword, tok) {
+					keep(i, t)
+					i = endLine
+					continue
+				}
+				ruleName = tok.keyword
+			}
+			kind = tokSimple
+		case tokVar:
+			ruleName = matchingRule(matchers, tok.body)
+		}
+
+		// Check if we should skip indenting this simple function
+		if ruleName != "" {
+			rule := config.Rules.Indent[ruleName]
+			if dirs.ruleDisabled(t, ruleName, rule.Disabled || matchesExcludePattern(filePath, rule.Exclude)) && !yamlSafe(config, dirs, t, ruleName, tok) {
+				keep(i, t)
+				i = endLine
+				continue // Skip indenting this token
+			}
+		}
+
+		// Вычисляем уровень отступа
+		level := depth
+		if kind == tokElse || kind == tokEnd {
+			if level > 0 {
+				level--
+			}
+		}
+
+		// Apply indentation
+		indent := config.indentOf(level)
+		if !reindent(i, first, indent, first == t && writesOutput(tok)) {
+			keep(i, t)
+			i = endLine
+			continue
+		}
+		lines[i] = indent + strings.TrimLeft(lines[i], " \t")
+		layout(i, t)
+
+		i = endLine
+	}
+
+	return strings.Join(lines, "\n"), notes
+}
+
+// leadingWhitespaceLeaks reports whether the whitespace before tokens[k], at
+// the start of its line, is part of the rendered output: neither the tag
+// ({{-) nor the tag before it (-}}) trims it.
+func leadingWhitespaceLeaks(src string, tokens []token, k int) bool {
+	if tokens[k].leftTrim {
+		return false
+	}
+	j := k - 1
+	if j >= 0 && tokens[j].typ == tokText && strings.TrimSpace(src[tokens[j].pos:tokens[j].end]) == "" {
+		j--
+	}
+	return j < 0 || tokens[j].typ == tokText || !tokens[j].rightTrim
+}
+
+// leadingWhitespaceBlank reports whether the line starting with tokens[k]
+// renders as nothing but its leaked indentation and its line break: its tags
+// write nothing, no text follows them, and none trims the line break.
+func leadingWhitespaceBlank(src string, tokens []token, k int) bool {
+	for j := k; j < len(tokens); j++ {
+		switch tok := tokens[j]; tok.typ {
+		case tokText:
+			text := src[tok.pos:tok.end]
+			nl := strings.IndexByte(text, '\n')
+			if nl < 0 {
+				nl = len(text)
+			}
+			if tokens[j-1].rightTrim || strings.TrimSpace(text[:nl]) != "" {
+				return false
+			}
+			if nl < len(text) {
+				return true
+			}
+		case tokAction:
+			if writesOutput(tok) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// writesOutput reports whether an action may write to the output. Control
+// actions other than block, and assignments, write nothing.
+func writesOutput(tok token) bool {
+	switch tok.kind {
+	case tokControlOpen:
+		return tok.keyword == "block"
+	case tokElse, tokEnd, tokVar:
+		return false
+	}
+	return true
+}
+
+// addLeftTrim adds a left trim marker to the tag that starts line after its
+// indentation.
+func addLeftTrim(line string) string {
+	n := leadingWhitespace(line)
+	rest := line[n+len(leftDelim):]
+	if strings.HasPrefix(rest, " ") {
+		return line[:n] + leftDelim + "-" + rest
+	}
+	return line[:n] + leftDelim + "- " + rest
+}
+
+// classifyAction determines the kind of an action from its body and returns
+// it together with the first word of the body.
+func classifyAction(body string) (tokenKind, string) {
+	if varRe.MatchString(body) {
+		return tokVar, "$"
+	}
+	matches := firstWordRe.FindStringSubmatch(body)
+	if matches == nil {
+		return tokNone, ""
+	}
+	switch keyword := matches[1]; keyword {
+	case "if", "range", "with", "define", "block":
+		return tokControlOpen, keyword
+	case "else":
+		return tokElse, keyword
+	case "end":
+		return tokEnd, keyword
+	default:
+		return tokNone, keyword
+	}
+}
+
+// nextDepth returns the nesting depth after tok.
+func nextDepth(depth int, tok token) int {
+	if tok.typ != tokAction {
+		return depth
+	}
+	switch tok.kind {
+	case tokControlOpen:
+		depth++
+	case tokEnd:
+		if depth > 0 {
+			depth--
+		}
+	}
+	return depth
+}
+
+// tagAt returns the index of the action or comment starting exactly at offset
+// off, searching from tokens[from], or -1 if no tag starts there.
+func tagAt(tokens []token, from, off int) int {
+	for k := from; k < len(tokens) && tokens[k].pos <= off; k++ {
+		if tokens[k].pos == off && tokens[k].typ != tokText {
+			return k
+		}
+	}
+	return -1
+}
+
+// followingTag returns the index of the tag that follows tokens[k] on the same
+// line, separated only by spaces or tabs, or -1 if there is none.
+func followingTag(src string, tokens []token, k int) int {
+	k++
+	if k < len(tokens) && tokens[k].typ == tokText {
+		if strings.Trim(src[tokens[k].pos:tokens[k].end], " \t") != "" {
+			return -1
+		}
+		k++
+	}
+	if k < len(tokens) && tokens[k].typ != tokText {
+		return k
+	}
+	return -1
+}
+
+// blankUntilEOL reports whether src holds only whitespace from off to the end
+// of that line.
+func blankUntilEOL(src string, off int) bool {
+	rest := src[off:]
+	if nl := strings.IndexByte(rest, '\n'); nl >= 0 {
+		rest = rest[:nl]
+	}
+	return strings.TrimSpace(rest) == ""
+}
+
+// lineOffsets returns the byte offset at which each line starts.
+func lineOffsets(lines []string) []int {
+	starts := make([]int, len(lines))
+	off := 0
+	for i, line := range lines {
+		starts[i] = off
+		off += len(line) + 1
+	}
+	return starts
+}
+
+// lineIndex returns the index of the line containing byte offset off.
+func lineIndex(starts []int, off int) int {
+	return sort.Search(len(starts), func(i int) bool { return starts[i] > off }) - 1
+}
+
+// leadingWhitespace returns the number of leading space/tab characters.
+func leadingWhitespace(line string) int {
+	n := 0
+	for n < len(line) && (line[n] == ' ' || line[n] == '\t') {
+		n++
+	}
+	return n
+}
+
+// shiftIndent adjusts a line's leading indentation by delta columns (clamped at
+// zero) while keeping the rest of the line verbatim. Tabs count up to the next
+// tab stop, and the new indentation is written in config's indent style.
+// Blank lines, and lines that don't move, are untouched.
+func shiftIndent(line string, delta int, config *Config) string {
+	if strings.TrimSpace(line) == "" || delta == 0 {
+		return line
+	}
+	cur := leadingWhitespace(line)
+	return config.whitespace(max(config.width(line[:cur])+delta, 0)) + line[cur:]
+}
+
+func matchesExcludePattern(filePath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		// Convert glob pattern to regex
+		if matched, _ := filepath.Match(pattern, filePath); matched {
+			return true
+		}
+
+		// Also support regex patterns (globs such as "*.yaml" aren't valid regexes)
+		if re, err := regexp.Compile(pattern); err == nil && re.MatchString(filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// An action whose output is the result of nindent/indent: a pipeline
+	// ending in it, or a direct call
+	indentPipeRe = regexp.MustCompile(`\|\s*n?indent\s+[^|]+$`)
+	indentCallRe = regexp.MustCompile(`^\s*n?indent\s`)
+)
+
+// yamlSafe reports whether YAML-aware mode indents tokens[k] although its rule
+// is disabled by config (see Config.YAMLAware). A directive disabling the rule
+// still wins.
+func yamlSafe(config *Config, dirs *directives, k int, ruleName string, tok token) bool {
+	if !config.YAMLAware || !tok.leftTrim || dirs.ruleDisabled(k, ruleName, false) {
+		return false
+	}
+	return indentPipeRe.MatchString(tok.body) || indentCallRe.MatchString(tok.body)
+}
+
+// indentMatcher is the compiled pattern of an indent rule.
+type indentMatcher struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// compileIndentMatchers compiles the match patterns of the indent rules,
+// sorted by rule name.
+func compileIndentMatchers(config *Config) ([]indentMatcher, error) {
+	var matchers []indentMatcher
+	for name, rule := range config.Rules.Indent {
+		if rule.Match == "" {
+			continue
+		}
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rules.indent.%s.match: %w", name, err)
+		}
+		matchers = append(matchers, indentMatcher{name: name, re: re})
+	}
+	sort.Slice(matchers, func(i, j int) bool { return matchers[i].name < matchers[j].name })
+	return matchers, nil
+}
+
+// indentRule returns the name of the indent rule of an action, or "" if it
+// has none: the rule named after its first word (printf, include, fail...),
+// unless that rule has a pattern, or else the first rule whose pattern
+// matches the body.
+func indentRule(config *Config, matchers []indentMatcher, tok token) string {
+	if rule, ok := config.Rules.Indent[tok.keyword]; ok && rule.Match == "" {
+		return tok.keyword
+	}
+	return matchingRule(matchers, tok.body)
+}
+
+// matchingRule returns the name of the first rule whose pattern matches body.
+func matchingRule(matchers []indentMatcher, body string) string {
+	for _, m := range matchers {
+		if m.re.MatchString(strings.TrimSpace(body)) {
+			return m.name
+		}
+	}
+	return ""
+}
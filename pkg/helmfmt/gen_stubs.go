@@ -36,7 +36,7 @@ func main() {
 
 	fmt.Fprintln(out, "// Code generated by go generate -- DO NOT EDIT")
 	fmt.Fprintln(out, "// Regenerate with: go generate ./...")
-	fmt.Fprintln(out, "package main")
+	fmt.Fprintln(out, "package helmfmt")
 	fmt.Fprintln(out)
 	fmt.Fprintln(out, "// sprigStubNames contains every function name registered by sprig")
 	fmt.Fprintln(out, "// (minus env/expandenv which Helm drops). One no-op stub is registered")
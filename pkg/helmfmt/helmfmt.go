@@ -0,0 +1,348 @@
+// Package helmfmt formats Helm chart templates: it indents template actions
+// by their nesting and normalizes whitespace inside them, leaving the YAML
+// around them untouched.
+//
+// The package works on in-memory sources only; it never reads files, stdin
+// or the working directory.
+//
+//go:generate go run gen_stubs.go
+package helmfmt
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Config holds the formatting rules.
+type Config struct {
+	IndentSize int         `json:"indent_size"`
+	Extensions []string    `json:"extensions"`
+	Ignore     []string    `json:"ignore"`
+	Rules      RulesConfig `json:"rules"`
+	// YAMLAware indents actions whose indent rule is disabled, or which have
+	// none, when their output can't depend on the indentation of their line:
+	// the action trims the whitespace before it ({{-) and its output starts
+	// with nindent or indent, so only the indentation it emits counts.
+	YAMLAware bool `json:"yaml_aware"`
+	// LeadingWhitespace says what to do with a line whose indentation would
+	// change the rendered output, because no trim marker removes it: one of
+	// the LeadingWhitespace constants, "" meaning LeadingWhitespaceIndent.
+	LeadingWhitespace string `json:"leading_whitespace"`
+	// MaxLineLength, if positive, is the length in characters past which an
+	// action starting a line is split across lines (see wrapLongActions).
+	MaxLineLength int `json:"max_line_length"`
+	// ContinuationIndent says how the lines after the first of a multi-line
+	// action are indented: one of the Continuation constants, "" meaning
+	// ContinuationBlock with MaxLineLength and ContinuationFlatten without.
+	ContinuationIndent string `json:"continuation_indent"`
+	// IndentStyle indents with spaces, IndentSize per level, or with tabs,
+	// one per level: one of the IndentStyle constants, "" meaning
+	// IndentStyleSpace.
+	IndentStyle string `json:"indent_style"`
+	// TabWidth is the number of columns between tab stops, used to measure
+	// existing indentation and line lengths; 0 means 8.
+	TabWidth int `json:"tab_width"`
+	// WarnTabs adds a note for each YAML line indented with a tab.
+	WarnTabs bool `json:"warn_tabs"`
+}
+
+// Values of Config.ContinuationIndent.
+const (
+	ContinuationFlatten = "flatten" // like the tag
+	ContinuationBlock   = "block"   // a level deeper than the tag, and one more per open parenthesis
+	ContinuationAlign   = "align"   // under the first argument of the innermost open call
+)
+
+// Values of Config.IndentStyle.
+const (
+	IndentStyleSpace = "space"
+	IndentStyleTab   = "tab"
+)
+
+// Values of Config.LeadingWhitespace.
+const (
+	LeadingWhitespaceIndent = "indent" // reindent anyway, with a note
+	LeadingWhitespaceSkip   = "skip"   // leave the line alone, with a note
+	LeadingWhitespaceTrim   = "trim"   // add {{- if the tag writes nothing, else skip
+)
+
+// Note is a remark about a line of a formatted template, such as why it was
+// left alone.
+type Note struct {
+	Line    int    `json:"line"` // 1-based
+	Rule    string `json:"rule"` // one of the Note constants
+	Message string `json:"message"`
+}
+
+// Values of Note.Rule: the setting that made the note.
+const (
+	NoteLeadingWhitespace = "leading_whitespace" // the line's indentation reaches the rendered output
+	NoteTrim              = "trim"               // a trim rule changed the line's markers
+	NoteTabs              = "warn_tabs"          // the YAML line is indented with a tab
+)
+
+// RulesConfig holds the rule families, each keyed by rule name.
+type RulesConfig struct {
+	Indent  map[string]RuleConfig `json:"indent"`
+	Spacing map[string]RuleConfig `json:"spacing"`
+	Trim    map[string]RuleConfig `json:"trim"`
+}
+
+// RuleConfig enables a rule, except for the files matching Exclude (globs or
+// regular expressions).
+type RuleConfig struct {
+	Disabled bool     `json:"disabled"`
+	Exclude  []string `json:"exclude"`
+	// Match, for an indent rule, is a regular expression matched against
+	// the action body. A rule with a pattern applies to the actions it
+	// matches, whatever their first word, instead of to the function it is
+	// named after; it also applies to assignments ({{ $_ := set ... }}),
+	// which are indented otherwise.
+	Match string `json:"match,omitempty"`
+}
+
+// Spacing rule names, configured under rules.spacing.
+const (
+	SpacingDelimiters = "delimiters" // {{.X}} => {{ .X }}, {{-if .X-}} => {{- if .X -}}
+	SpacingAssignment = "assignment" // $x:=1 => $x := 1
+	SpacingPipe       = "pipe"       // .X|quote => .X | quote
+)
+
+// Trim rule names, configured under rules.trim. They apply to control tags
+// alone on their line, and only where the rendered output stays the same.
+const (
+	TrimAddLeft   = "add_left"   // {{ end }} => {{- end }}
+	TrimDropRight = "drop_right" // {{- if .X -}} => {{- if .X }}
+)
+
+// DefaultConfig returns the built-in configuration.
+func DefaultConfig() *Config {
+	return &Config{
+		IndentSize:        2,
+		IndentStyle:       IndentStyleSpace,
+		TabWidth:          defaultTabWidth,
+		Extensions:        []string{".yaml", ".yml", ".tpl"},
+		Ignore:            []string{},
+		LeadingWhitespace: LeadingWhitespaceIndent,
+		Rules: RulesConfig{
+			Indent: map[string]RuleConfig{
+				"tpl":      {Disabled: true, Exclude: []string{}},
+				"toYaml":   {Disabled: true, Exclude: []string{}},
+				"template": {Disabled: true, Exclude: []string{}},
+				"include":  {Disabled: true, Exclude: []string{}},
+				"printf":   {Disabled: false, Exclude: []string{}},
+				"fail":     {Disabled: false, Exclude: []string{}},
+			},
+			Spacing: map[string]RuleConfig{
+				SpacingDelimiters: {Disabled: true, Exclude: []string{}},
+				SpacingAssignment: {Disabled: true, Exclude: []string{}},
+				SpacingPipe:       {Disabled: true, Exclude: []string{}},
+			},
+			Trim: map[string]RuleConfig{
+				TrimAddLeft:   {Disabled: true, Exclude: []string{}},
+				TrimDropRight: {Disabled: true, Exclude: []string{}},
+			},
+		},
+	}
+}
+
+// Ignored reports whether name matches one of the Ignore patterns. Patterns
+// are globs matched as in .helmignore: one with a slash against the whole
+// path, a leading slash being optional, one without against the base name,
+// and a trailing slash restricts it to directories. A path is ignored if it
+// or one of its parent directories matches.
+func (c *Config) Ignored(name string) bool {
+	parts := strings.Split(filepath.ToSlash(name), "/")
+	for _, pattern := range c.Ignore {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		pattern = strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "/")
+		for i := len(parts); i > 0; i-- {
+			if dirOnly && i == len(parts) {
+				continue
+			}
+			target := strings.Join(parts[:i], "/")
+			if !strings.Contains(pattern, "/") {
+				target = parts[i-1]
+			}
+			if ok, _ := path.Match(pattern, target); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Options control a single Format or Check call.
+type Options struct {
+	// Config holds the rules; nil means DefaultConfig().
+	Config *Config
+	// Filename is matched against the exclude patterns of the rules. It is
+	// never opened.
+	Filename string
+	// Lines, if set, limits rewriting to these lines. Nesting is still
+	// computed from the whole source.
+	Lines []LineRange
+	// SkipValidation formats the source even if it doesn't parse, as is usual
+	// while a template is being typed in an editor.
+	SkipValidation bool
+}
+
+// LineRange is an inclusive range of 1-based line numbers.
+type LineRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+func (r LineRange) String() string {
+	if r.Start == r.End {
+		return fmt.Sprintf("line %d", r.Start)
+	}
+	return fmt.Sprintf("lines %d-%d", r.Start, r.End)
+}
+
+// Format returns src formatted. Unless opts.SkipValidation is set, a source
+// that isn't a valid template is rejected with the error of Validate.
+func Format(src []byte, opts Options) ([]byte, error) {
+	formatted, _, err := FormatWithNotes(src, opts)
+	return formatted, err
+}
+
+// FormatWithNotes is Format, also returning notes about the lines whose
+// indentation reaches the rendered output (see Config.LeadingWhitespace) and
+// the lines whose trim markers were changed by a trim rule.
+// With opts.Lines, only notes about the selected lines are returned.
+func FormatWithNotes(src []byte, opts Options) ([]byte, []Note, error) {
+	config := opts.Config
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if err := checkConfig(config); err != nil {
+		return nil, nil, err
+	}
+
+	orig := string(src)
+	var formatted string
+	var notes []Note
+	if opts.SkipValidation {
+		formatted, notes = formatTrim(formatSpacing(orig, config, opts.Filename), config, opts.Filename)
+		var indentNotes []Note
+		formatted, indentNotes = formatIndentation(formatted, config, opts.Filename)
+		formatted = ensureTrailingNewline(formatted)
+		notes = sortNotes(append(notes, indentNotes...))
+	} else {
+		var err error
+		if formatted, notes, err = formatTemplate(orig, config, opts.Filename); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(opts.Lines) > 0 {
+		formatted = mergeLines(orig, formatted, opts.Lines)
+		selected := notes[:0]
+		for _, n := range notes {
+			for _, r := range opts.Lines {
+				if n.Line >= r.Start && n.Line <= r.End {
+					selected = append(selected, n)
+					break
+				}
+			}
+		}
+		notes = selected
+	}
+	// Wrapping adds lines, so it comes after mergeLines, which pairs the
+	// lines of both versions by index
+	formatted = wrapLongActions(formatted, config, opts.Lines)
+	return []byte(formatted), notes, nil
+}
+
+// checkConfig rejects the values of config that formatting can't use.
+func checkConfig(config *Config) error {
+	switch config.LeadingWhitespace {
+	case "", LeadingWhitespaceIndent, LeadingWhitespaceSkip, LeadingWhitespaceTrim:
+	default:
+		return fmt.Errorf("leading_whitespace: unknown value %q", config.LeadingWhitespace)
+	}
+	switch config.IndentStyle {
+	case "", IndentStyleSpace, IndentStyleTab:
+	default:
+		return fmt.Errorf("indent_style: unknown value %q", config.IndentStyle)
+	}
+	if config.TabWidth < 0 {
+		return fmt.Errorf("tab_width: must be 1 or more, got %d", config.TabWidth)
+	}
+	switch config.ContinuationIndent {
+	case "", ContinuationFlatten, ContinuationBlock, ContinuationAlign:
+	default:
+		return fmt.Errorf("continuation_indent: unknown value %q", config.ContinuationIndent)
+	}
+	if config.MaxLineLength < 0 {
+		return fmt.Errorf("max_line_length: must be 0 (no limit) or more, got %d", config.MaxLineLength)
+	}
+	for _, pattern := range config.Ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("ignore: %q: %w", pattern, err)
+		}
+	}
+	_, err := compileIndentMatchers(config)
+	return err
+}
+
+// Check reports whether src is already formatted. A missing newline at the
+// end of the source alone doesn't make it unformatted.
+func Check(src []byte, opts Options) (bool, error) {
+	formatted, err := Format(src, opts)
+	if err != nil {
+		return false, err
+	}
+	return IsFormatted(src, formatted), nil
+}
+
+// IsFormatted reports whether src is unchanged by formatting into formatted,
+// up to a missing final newline.
+func IsFormatted(src, formatted []byte) bool {
+	orig, out := string(src), string(formatted)
+	return out == orig || out == orig+"\n"
+}
+
+// SyntaxError is the error of a source that doesn't parse as a Helm template.
+type SyntaxError struct {
+	Line   int // 1-based, 0 if unknown
+	Column int // 1-based byte offset in the line, 0 if unknown
+	Err    error
+}
+
+func (e *SyntaxError) Error() string {
+	return "invalid template syntax: " + e.Err.Error()
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// Validate reports whether src parses as a Helm template, with every sprig and
+// Helm function available. The error is a *SyntaxError.
+func Validate(src []byte) error {
+	return validateTemplateSyntax(string(src))
+}
+
+// mergeLines returns orig with the lines in ranges replaced by the lines of
+// formatted. Formatting, up to wrapping which comes later, never adds or
+// removes line breaks inside the file, so lines correspond by index.
+func mergeLines(orig, formatted string, ranges []LineRange) string {
+	lines := strings.Split(orig, "\n")
+	formattedLines := strings.Split(formatted, "\n")
+	for _, r := range ranges {
+		for n := max(r.Start, 1); n <= r.End && n <= len(lines) && n <= len(formattedLines); n++ {
+			lines[n-1] = formattedLines[n-1]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func ensureTrailingNewline(s string) string {
+	if strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
@@ -0,0 +1,144 @@
+package helmfmt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func ExampleFormat() {
+	src := "{{- if .Values.enabled }}\n{{- $name := include \"app.name\" . }}\n{{- end }}\n"
+	out, err := Format([]byte(src), Options{Filename: "templates/app.yaml"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(string(out))
+	// Output:
+	// {{- if .Values.enabled }}
+	//   {{- $name := include "app.name" . }}
+	// {{- end }}
+}
+
+func TestFormatLines(t *testing.T) {
+	src := "{{- if .X }}\n{{- $a := 1 }}\n{{- if .Y }}\n{{- $b := 2 }}\n{{- end }}\n{{- end }}"
+	tests := []struct {
+		name     string
+		ranges   []LineRange
+		expected string
+	}{
+		{
+			name:     "inner block only",
+			ranges:   []LineRange{{Start: 4, End: 4}},
+			expected: "{{- if .X }}\n{{- $a := 1 }}\n{{- if .Y }}\n    {{- $b := 2 }}\n{{- end }}\n{{- end }}",
+		},
+		{
+			name:     "several ranges",
+			ranges:   []LineRange{{Start: 2, End: 2}, {Start: 5, End: 5}},
+			expected: "{{- if .X }}\n  {{- $a := 1 }}\n{{- if .Y }}\n{{- $b := 2 }}\n  {{- end }}\n{{- end }}",
+		},
+		{
+			name:     "range past the end of the file",
+			ranges:   []LineRange{{Start: 6, End: 100}},
+			expected: src,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format([]byte(src), Options{Lines: tt.ranges})
+			if err != nil {
+				t.Fatalf("Format: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("unexpected result\nExpected:\n%s\nGot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCheckAndValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		formatted bool
+		invalid   bool
+	}{
+		{name: "formatted", src: "{{- if .X }}\n  {{- $a := 1 }}\n{{- end }}\n", formatted: true},
+		{name: "missing final newline", src: "{{- if .X }}\n  {{- $a := 1 }}\n{{- end }}", formatted: true},
+		{name: "unformatted", src: "{{- if .X }}\n{{- $a := 1 }}\n{{- end }}\n"},
+		{name: "invalid", src: "{{- if .X }}\n{{- $a := 1 }}\n", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate([]byte(tt.src)); (err != nil) != tt.invalid {
+				t.Errorf("Validate: unexpected error %v", err)
+			}
+			formatted, err := Check([]byte(tt.src), Options{})
+			if (err != nil) != tt.invalid {
+				t.Fatalf("Check: unexpected error %v", err)
+			}
+			if formatted != tt.formatted {
+				t.Errorf("Check: expected %v, got %v", tt.formatted, formatted)
+			}
+		})
+	}
+
+	// Syntax errors tell where the parser stopped
+	for _, tt := range []struct {
+		src          string
+		line, column int
+	}{
+		{src: "a: 1\nb: {{ .Y | bogus }}\n", line: 2, column: 12},
+		{src: "a: {{ .x\n  | bogus }}\n", line: 2, column: 5},
+		{src: "a: {{ end }}\n", line: 1, column: 4},
+		{src: "{{- if .X }}\n", line: 2},
+	} {
+		var se *SyntaxError
+		if err := Validate([]byte(tt.src)); !errors.As(err, &se) || se.Line != tt.line || se.Column != tt.column {
+			t.Errorf("%q: expected a syntax error at %d:%d, got %v", tt.src, tt.line, tt.column, err)
+		}
+	}
+
+	// Incomplete templates can still be formatted on request
+	got, err := Format([]byte("{{- if .X }}\n{{- $a := 1 }}\n"), Options{SkipValidation: true})
+	if err != nil || string(got) != "{{- if .X }}\n  {{- $a := 1 }}\n" {
+		t.Errorf("SkipValidation: unexpected result %q, %v", got, err)
+	}
+
+	config := DefaultConfig()
+	config.Rules.Indent["pipes"] = RuleConfig{Match: "|("}
+	if _, err := Format([]byte("{{ .X | quote }}\n"), Options{Config: config}); err == nil || !strings.Contains(err.Error(), "rules.indent.pipes.match") {
+		t.Errorf("expected an invalid pattern error, got %v", err)
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	config := DefaultConfig()
+	config.Ignore = []string{"templates/tests/*", "*.tpl", "/generated/", "vendor"}
+	tests := []struct {
+		path    string
+		ignored bool
+	}{
+		{"templates/tests/a.yaml", true},
+		{"templates/tests-helper.yaml", false},
+		{"templates/tests/sub/a.yaml", true},
+		{"templates/_helpers.tpl", true},
+		{"templates/tpl.yaml", false},
+		{"generated/a.yaml", true},
+		{"generated", false},
+		{"templates/vendor/a.yaml", true},
+		{"templates/vendors.yaml", false},
+	}
+	for _, tt := range tests {
+		if got := config.Ignored(tt.path); got != tt.ignored {
+			t.Errorf("%s: expected ignored=%v, got %v", tt.path, tt.ignored, got)
+		}
+	}
+
+	config.Ignore = []string{"templates/[a-"}
+	if _, err := Format([]byte("a: 1\n"), Options{Config: config}); err == nil {
+		t.Error("expected an invalid glob to be rejected")
+	}
+}
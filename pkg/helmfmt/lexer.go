@@ -0,0 +1,169 @@
+package helmfmt
+
+import "strings"
+
+// tokenType distinguishes the three kinds of lexemes a template source is
+// split into.
+type tokenType int
+
+const (
+	tokText    tokenType = iota // raw text between tags
+	tokAction                   // {{ ... }}
+	tokComment                  // {{/* ... */}}
+)
+
+const (
+	leftDelim    = "{{"
+	rightDelim   = "}}"
+	leftComment  = "/*"
+	rightComment = "*/"
+	trimMarker   = '-'
+)
+
+// token is a single lexeme of a template source. Offsets are byte offsets
+// into the source; for tags they cover everything from the opening "{{" up to
+// and including the closing "}}".
+type token struct {
+	typ       tokenType
+	pos       int
+	end       int
+	leftTrim  bool   // tag opens with "{{- "
+	rightTrim bool   // tag closes with " -}}"
+	body      string // action body without delimiters and trim markers, or comment text
+
+	kind    tokenKind // classification of an action, see classifyAction
+	keyword string    // first word of the action ("if", "include", "$", ...)
+}
+
+// lexTemplate splits src into text, action and comment tokens. It follows the
+// same rules as the text/template/parse lexer: a trim marker is a '-' that is
+// followed (or preceded, on the right) by a space, a comment must directly
+// follow the opening delimiter, and "}}" inside quoted strings, raw strings
+// and character constants does not close an action.
+//
+// The lexer is lenient: an unterminated tag turns the rest of the input into
+// text instead of failing, since syntax is validated separately by
+// validateTemplateSyntax. The kinds of control actions are guessed from their
+// first word; applyParseTree replaces them with what the parser makes of the
+// source, for the passes that follow nesting.
+func lexTemplate(src string) []token {
+	var tokens []token
+	pos := 0
+	for pos < len(src) {
+		x := strings.Index(src[pos:], leftDelim)
+		if x < 0 {
+			break
+		}
+		start := pos + x
+		tok, ok := lexTag(src, start)
+		if !ok {
+			break
+		}
+		if start > pos {
+			tokens = append(tokens, token{typ: tokText, pos: pos, end: start})
+		}
+		tokens = append(tokens, tok)
+		pos = tok.end
+	}
+	if pos < len(src) {
+		tokens = append(tokens, token{typ: tokText, pos: pos, end: len(src)})
+	}
+	return tokens
+}
+
+// lexTag lexes the tag that starts at src[start:], which must begin with "{{".
+func lexTag(src string, start int) (token, bool) {
+	tok := token{pos: start}
+	pos := start + len(leftDelim)
+	if hasLeftTrimMarker(src[pos:]) {
+		tok.leftTrim = true
+		pos += 2
+	}
+
+	if strings.HasPrefix(src[pos:], leftComment) {
+		x := strings.Index(src[pos+len(leftComment):], rightComment)
+		if x < 0 {
+			return tok, false
+		}
+		tok.body = src[pos+len(leftComment) : pos+len(leftComment)+x]
+		pos += len(leftComment) + x + len(rightComment)
+		delimLen, trim := atRightDelim(src[pos:])
+		if delimLen == 0 {
+			return tok, false
+		}
+		tok.typ = tokComment
+		tok.rightTrim = trim
+		tok.end = pos + delimLen
+		return tok, true
+	}
+
+	tok.typ = tokAction
+	bodyStart := pos
+	for pos < len(src) {
+		if delimLen, trim := atRightDelim(src[pos:]); delimLen > 0 {
+			tok.rightTrim = trim
+			tok.body = src[bodyStart:pos]
+			tok.end = pos + delimLen
+			tok.kind, tok.keyword = classifyAction(tok.body)
+			return tok, true
+		}
+		switch src[pos] {
+		case '"', '\'':
+			pos = skipQuoted(src, pos)
+		case '`':
+			if x := strings.IndexByte(src[pos+1:], '`'); x >= 0 {
+				pos += x + 2
+			} else {
+				return tok, false
+			}
+		default:
+			pos++
+		}
+	}
+	return tok, false
+}
+
+// skipQuoted returns the offset just past the interpreted string or character
+// constant starting at src[pos]. Like the template lexer, it stops at a
+// newline, which makes the string unterminated.
+func skipQuoted(src string, pos int) int {
+	quote := src[pos]
+	pos++
+	for pos < len(src) {
+		switch src[pos] {
+		case '\\':
+			pos += 2
+			continue
+		case '\n':
+			return pos
+		case quote:
+			return pos + 1
+		}
+		pos++
+	}
+	return pos
+}
+
+// atRightDelim reports the length of the closing delimiter at the start of s
+// (0 if there is none) and whether it carries a trim marker.
+func atRightDelim(s string) (int, bool) {
+	if hasRightTrimMarker(s) && strings.HasPrefix(s[2:], rightDelim) {
+		return 2 + len(rightDelim), true
+	}
+	if strings.HasPrefix(s, rightDelim) {
+		return len(rightDelim), false
+	}
+	return 0, false
+}
+
+func hasLeftTrimMarker(s string) bool {
+	return len(s) >= 2 && s[0] == trimMarker && isSpace(s[1])
+}
+
+func hasRightTrimMarker(s string) bool {
+	return len(s) >= 2 && isSpace(s[0]) && s[1] == trimMarker
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,252 @@
+package helmfmt
+
+import (
+	"sort"
+	"text/template/parse"
+)
+
+// applyParseTree sets the kind of the control actions of tokens, the ones that
+// open, continue or close a nested list, from the parse tree of src, so that
+// nesting is what Helm parses rather than what the first word of each action
+// suggests. The tree has no node for {{ else }}, {{ end }} and {{ define }},
+// so these are found among the actions that hold no node. A source that
+// doesn't parse, or whose tags the parser splits otherwise than lexTemplate,
+// keeps the kinds of classifyAction. Functions aren't checked: they don't
+// change nesting, and validateTemplateSyntax checks them against the Helm
+// function set.
+func applyParseTree(src string, tokens []token) {
+	tree := parse.New("nesting")
+	tree.Mode = parse.SkipFuncCheck
+	treeSet := map[string]*parse.Tree{}
+	if _, err := tree.Parse(src, leftDelim, rightDelim, treeSet); err != nil {
+		return
+	}
+
+	w := &nestingWalker{
+		tokens:  tokens,
+		owned:   make([]bool, len(tokens)),
+		kinds:   make([]tokenKind, len(tokens)),
+		treeSet: treeSet,
+		walked:  map[*parse.Tree]bool{tree: true},
+	}
+	w.own(tree.Root)
+	for _, t := range treeSet {
+		if t != tree {
+			w.own(t.Root)
+		}
+	}
+
+	w.list(tree.Root, -1)
+	// Definitions, in source order
+	var defs []*parse.Tree
+	for _, t := range treeSet {
+		if !w.walked[t] {
+			defs = append(defs, t)
+		}
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Root.Pos < defs[j].Root.Pos })
+	for _, t := range defs {
+		open := w.prevFree(w.at(t.Root.Pos))
+		if open < 0 {
+			w.failed = true
+			break
+		}
+		w.kinds[open] = tokControlOpen
+		w.close(w.list(t.Root, open))
+	}
+	// What is left are the definitions dropped from treeSet for an empty
+	// body: their bodies hold no action, so their tags pair up in order
+	open := true
+	for k := range tokens {
+		if tokens[k].typ != tokAction || w.owned[k] || w.kinds[k] != tokNone {
+			continue
+		}
+		if open {
+			w.kinds[k] = tokControlOpen
+		} else {
+			w.kinds[k] = tokEnd
+		}
+		open = !open
+	}
+	if w.failed || !open {
+		return
+	}
+
+	for k := range tokens {
+		if tokens[k].typ != tokAction {
+			continue
+		}
+		switch {
+		case w.kinds[k] != tokNone:
+			tokens[k].kind = w.kinds[k]
+		case tokens[k].kind == tokControlOpen || tokens[k].kind == tokElse || tokens[k].kind == tokEnd:
+			tokens[k].kind = tokNone
+		}
+	}
+}
+
+// nestingWalker walks a parse tree along the tokens of its source.
+type nestingWalker struct {
+	tokens  []token
+	owned   []bool      // the action holds a node of the tree
+	kinds   []tokenKind // control kind found for each token
+	treeSet map[string]*parse.Tree
+	walked  map[*parse.Tree]bool // trees whose nodes were classified
+	failed  bool                 // the tokens don't match the tree
+}
+
+// at returns the index of the token holding byte offset pos.
+func (w *nestingWalker) at(pos parse.Pos) int {
+	return sort.Search(len(w.tokens), func(k int) bool { return w.tokens[k].end > int(pos) })
+}
+
+// own marks the actions holding the nodes of list, and of the lists nested
+// in them.
+func (w *nestingWalker) own(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, n := range list.Nodes {
+		if k := w.at(n.Position()); k < len(w.tokens) && w.tokens[k].typ == tokAction {
+			w.owned[k] = true
+		}
+		switch n := n.(type) {
+		case *parse.IfNode:
+			w.own(n.List)
+			w.own(n.ElseList)
+		case *parse.RangeNode:
+			w.own(n.List)
+			w.own(n.ElseList)
+		case *parse.WithNode:
+			w.own(n.List)
+			w.own(n.ElseList)
+		}
+	}
+}
+
+// nextFree returns the first action after tokens[k] that holds no node, or
+// -1 if there is none.
+func (w *nestingWalker) nextFree(k int) int {
+	for k++; k < len(w.tokens); k++ {
+		if w.tokens[k].typ == tokAction && !w.owned[k] {
+			return k
+		}
+	}
+	return -1
+}
+
+// prevFree returns the last action before tokens[k] that holds no node and
+// wasn't classified yet, or -1 if there is none.
+func (w *nestingWalker) prevFree(k int) int {
+	for k--; k >= 0; k-- {
+		if w.tokens[k].typ == tokAction && !w.owned[k] && w.kinds[k] == tokNone {
+			return k
+		}
+	}
+	return -1
+}
+
+// close marks the free action after tokens[last] as the end of a list and
+// returns its index.
+func (w *nestingWalker) close(last int) int {
+	end := w.nextFree(last)
+	if end < 0 {
+		w.failed = true
+		return last
+	}
+	w.kinds[end] = tokEnd
+	return end
+}
+
+// list walks the nodes of list, whose opening tag is tokens[last], and
+// returns the index of the last token they span.
+func (w *nestingWalker) list(list *parse.ListNode, last int) int {
+	if list == nil {
+		return last
+	}
+	for _, n := range list.Nodes {
+		last = max(last, w.node(n, tokControlOpen))
+	}
+	return last
+}
+
+// node walks n, whose tag is of the given kind if n is a control node, and
+// returns the index of the last token it spans.
+func (w *nestingWalker) node(n parse.Node, kind tokenKind) int {
+	k := w.at(n.Position())
+	if k == len(w.tokens) {
+		w.failed = true
+		return k - 1
+	}
+	if w.tokens[k].typ != tokAction {
+		if n.Type() != parse.NodeText {
+			w.failed = true
+		}
+		return k
+	}
+	switch n := n.(type) {
+	case *parse.IfNode:
+		return w.control(k, kind, n.List, n.ElseList)
+	case *parse.RangeNode:
+		return w.control(k, kind, n.List, n.ElseList)
+	case *parse.WithNode:
+		return w.control(k, kind, n.List, n.ElseList)
+	case *parse.TemplateNode:
+		// The parser made a template call of the tag, so its first word tells
+		// {{ block }} from {{ template }}. The body of a block is a tree of its
+		// own starting right after it, unless a definition of the same name
+		// replaced it.
+		if w.tokens[k].keyword != "block" {
+			return k
+		}
+		w.kinds[k] = tokControlOpen
+		last := k
+		if body := w.treeSet[n.Name]; body != nil && !w.walked[body] && w.adjacent(k, w.at(body.Root.Pos)) {
+			w.walked[body] = true
+			last = w.list(body.Root, k)
+		}
+		return w.close(last)
+	}
+	return k
+}
+
+// control walks an if, range or with node whose tag is tokens[k].
+func (w *nestingWalker) control(k int, kind tokenKind, list, elseList *parse.ListNode) int {
+	w.kinds[k] = kind
+	last := w.list(list, k)
+	if elseList != nil {
+		// {{ else if }} and {{ else with }} are a node of their own in the
+		// else list, sharing the {{ end }} of the outer node
+		if len(elseList.Nodes) == 1 {
+			chained := w.at(elseList.Nodes[0].Position())
+			if f := w.nextFree(last); f < 0 || f > chained {
+				switch elseList.Nodes[0].(type) {
+				case *parse.IfNode, *parse.WithNode:
+					return w.node(elseList.Nodes[0], tokElse)
+				}
+			}
+		}
+		e := w.nextFree(last)
+		if e < 0 {
+			w.failed = true
+			return last
+		}
+		w.kinds[e] = tokElse
+		last = w.list(elseList, e)
+	}
+	return w.close(last)
+}
+
+// adjacent reports whether only text and comments separate tokens[k] from
+// tokens[next].
+func (w *nestingWalker) adjacent(k, next int) bool {
+	if next <= k {
+		return false
+	}
+	for j := k + 1; j < next && j < len(w.tokens); j++ {
+		if w.tokens[j].typ == tokAction {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package helmfmt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyParseTree(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected string // kind of each action: ( opens, | continues, ) closes, . other
+	}{
+		{
+			name:     "else chains",
+			src:      `{{ if .a }}{{ .x }}{{ else if .b }}{{ else }}{{ if .d }}{{ end }}{{ end }}{{ with .a }}{{ else with .b }}{{ end }}`,
+			expected: "(.||())(|)",
+		},
+		{
+			name:     "range with break and else",
+			src:      `{{ range .a }}{{ if . }}{{ break }}{{ end }}{{ else }}{{ $x := 1 }}{{ end }}`,
+			expected: "((.)|.)",
+		},
+		{
+			name:     "define and block",
+			src:      "{{ define \"a\" }}\n{{- with .x }}{{ . }}{{ end }}\n{{ end }}\n{{ block \"b\" . }}{{/* c */}}{{ template \"a\" . }}{{ end }}\n{{ block \"c\" . }}{{ end }}",
+			expected: "((.))(.)()",
+		},
+		{
+			name:     "empty definitions dropped from the tree set",
+			src:      `{{ define "a" }} {{ end }}{{ define "a" }}{{ if .x }}{{ end }}{{ end }}{{ define "a" }}{{/* c */}}{{ end }}`,
+			expected: "()(())()",
+		},
+		{
+			name:     "delimiters in literals",
+			src:      "{{ if eq .a \"{{ end }}\" }}{{ printf `}}\n{{ if` }}{{ end }}",
+			expected: "(.)",
+		},
+		{
+			name:     "invalid template is left as lexed",
+			src:      `{{ if .a }}{{ end }}{{ end }}`,
+			expected: "...",
+		},
+	}
+
+	symbols := map[tokenKind]byte{tokControlOpen: '(', tokElse: '|', tokEnd: ')'}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := lexTemplate(tt.src)
+			for k := range tokens {
+				tokens[k].kind = tokNone
+			}
+			applyParseTree(tt.src, tokens)
+			var got strings.Builder
+			for _, tok := range tokens {
+				if tok.typ != tokAction {
+					continue
+				}
+				if c, ok := symbols[tok.kind]; ok {
+					got.WriteByte(c)
+				} else {
+					got.WriteByte('.')
+				}
+			}
+			if got.String() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,593 @@
+package helmfmt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// VerifyOptions describe how Verify renders a template.
+type VerifyOptions struct {
+	// Templates holds the other templates of the chart by name, for include
+	// and template.
+	Templates map[string][]byte
+	// Values and Chart are .Values and .Chart. Chart holds the keys of
+	// Chart.yaml, capitalized as Helm does (Name, Version...).
+	Values map[string]interface{}
+	Chart  map[string]interface{}
+	// Whitespace compares the outputs without trailing whitespace and blank
+	// lines, instead of byte for byte.
+	Whitespace bool
+}
+
+// Verify renders src and formatted, the template called name before and
+// after formatting, and returns an error describing the first difference
+// between the outputs. Besides the template itself, every template it
+// defines is rendered with the root context, so that changes to helpers are
+// caught too.
+//
+// Rendering uses real implementations of the Helm and sprig functions that
+// shape the output (include, tpl, toYaml, indent, nindent, trim, quote,
+// default...). The others return a placeholder built from their arguments:
+// equal on both sides, which is all a comparison needs.
+func Verify(name string, src, formatted []byte, opts VerifyOptions) error {
+	before, err := renderAll(name, string(src), opts)
+	if err != nil {
+		return err
+	}
+	after, err := renderAll(name, string(formatted), opts)
+	if err != nil {
+		return err
+	}
+
+	// The file must define the same templates before their outputs compare
+	names := renderNames(before)
+	for _, n := range names {
+		if _, ok := after[n]; !ok {
+			return fmt.Errorf("define %q is missing after formatting", n)
+		}
+	}
+	for _, n := range renderNames(after) {
+		if _, ok := before[n]; !ok {
+			return fmt.Errorf("define %q appears only after formatting", n)
+		}
+	}
+
+	for _, n := range names {
+		out, other := before[n], after[n]
+		want, got := out.text, other.text
+		if opts.Whitespace {
+			want, got = normalizeWhitespace(want), normalizeWhitespace(got)
+		}
+		if want != got {
+			return fmt.Errorf("%s: %s", out.describe(), firstDifference(want, got))
+		}
+		if out.err != other.err {
+			return fmt.Errorf("%s: render error changed from %q to %q", out.describe(), out.err, other.err)
+		}
+	}
+	return nil
+}
+
+// renderNames returns the template names of outputs, sorted.
+func renderNames(outputs map[string]renderOutput) []string {
+	names := make([]string, 0, len(outputs))
+	for n := range outputs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderOutput is the result of executing one template.
+type renderOutput struct {
+	name string // "" for the file itself, else the name of a define
+	text string
+	err  string // execution error without positions, "" if none
+}
+
+func (o renderOutput) describe() string {
+	if o.name == "" {
+		return "rendered output differs"
+	}
+	return fmt.Sprintf("rendered output of %q differs", o.name)
+}
+
+// positionRe matches the positions in template errors, which move when a
+// template is reindented.
+var positionRe = regexp.MustCompile(`:\d+(:\d+)?`)
+
+// renderAll renders src, parsed as name among the other templates of the
+// chart, and every template it defines, keyed by define name ("" for src).
+func renderAll(name, src string, opts VerifyOptions) (map[string]renderOutput, error) {
+	root := template.New(name)
+	root.Funcs(renderFuncMap(root))
+
+	// Parse the rest of the chart first, so that the defines of src win
+	others := make([]string, 0, len(opts.Templates))
+	for other := range opts.Templates {
+		if other != name {
+			others = append(others, other)
+		}
+	}
+	sort.Strings(others)
+	for _, other := range others {
+		// A template that doesn't parse can't be included: a failed parse
+		// leaves the set as it was
+		root.New(other).Parse(string(opts.Templates[other]))
+	}
+	defined := make(map[string]bool)
+	for _, t := range root.Templates() {
+		defined[t.Name()] = true
+	}
+
+	tmpl, err := root.New(name).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template syntax: %w", err)
+	}
+	names := []string{""}
+	for _, t := range tmpl.Templates() {
+		if n := t.Name(); n != name && (!defined[n] || definesTemplate(src, n)) {
+			names = append(names, n)
+		}
+	}
+
+	outputs := make(map[string]renderOutput, len(names))
+	for _, n := range names {
+		target := n
+		if n == "" {
+			target = name
+		}
+		var b bytes.Buffer
+		out := renderOutput{name: n}
+		if err := tmpl.ExecuteTemplate(&b, target, renderData(name, opts)); err != nil {
+			out.err = positionRe.ReplaceAllString(err.Error(), "")
+		}
+		// Helm drops the placeholder of missing values
+		out.text = strings.ReplaceAll(b.String(), "<no value>", "")
+		outputs[n] = out
+	}
+	return outputs, nil
+}
+
+// definesTemplate reports whether src holds a define of the template name.
+func definesTemplate(src, name string) bool {
+	return regexp.MustCompile(`\{\{-?\s*define\s+` + regexp.QuoteMeta(strconv.Quote(name))).MatchString(src)
+}
+
+// renderData returns the root context of a render, like Helm's. Templates can
+// change .Values and .Chart with set and unset, so each render gets its own
+// copy: renders of other templates, or of the other version of the same
+// template, must not see the changes.
+func renderData(name string, opts VerifyOptions) map[string]interface{} {
+	return map[string]interface{}{
+		"Values": copyValue(opts.Values),
+		"Chart":  copyValue(opts.Chart),
+		"Release": map[string]interface{}{
+			"Name":      "release-name",
+			"Namespace": "default",
+			"Service":   "Helm",
+			"Revision":  1,
+			"IsInstall": true,
+			"IsUpgrade": false,
+		},
+		"Capabilities": map[string]interface{}{
+			"KubeVersion": map[string]interface{}{"Version": "v1.30.0", "Major": "1", "Minor": "30"},
+			"APIVersions": apiVersions{"v1", "apps/v1", "batch/v1", "networking.k8s.io/v1"},
+		},
+		"Template": map[string]interface{}{"Name": name, "BasePath": "templates"},
+	}
+}
+
+// copyValue returns a deep copy of the mappings and lists of v. A nil mapping
+// is copied as an empty one.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = copyValue(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = copyValue(e)
+		}
+		return l
+	}
+	return v
+}
+
+// apiVersions is .Capabilities.APIVersions.
+type apiVersions []string
+
+// Has reports whether the API version is available.
+func (a apiVersions) Has(version string) bool {
+	for _, v := range a {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeWhitespace drops trailing whitespace and blank lines.
+func normalizeWhitespace(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimRight(line, " \t\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// firstDifference describes the first line where want and got differ.
+func firstDifference(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(w) || i < len(g); i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl || i >= len(w) || i >= len(g) {
+			return fmt.Sprintf("line %d was %q, is now %q", i+1, wl, gl)
+		}
+	}
+	return "outputs differ"
+}
+
+// maxIncludeDepth is how many include calls of the same template may be in
+// progress at once, as in Helm.
+const maxIncludeDepth = 1000
+
+// renderFuncMap returns the functions of a render of t: real implementations
+// of the functions that shape the output, and placeholders for the others.
+func renderFuncMap(t *template.Template) template.FuncMap {
+	f := make(template.FuncMap)
+	for name := range helmFuncMap() {
+		f[name] = placeholder(name)
+	}
+
+	indent := func(spaces int, s string) string {
+		pad := strings.Repeat(" ", spaces)
+		return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+	}
+	quote := func(q string) func(...interface{}) string {
+		return func(args ...interface{}) string {
+			var out []string
+			for _, arg := range args {
+				if arg != nil {
+					s := toString(arg)
+					if q == `"` {
+						s = strconv.Quote(s)
+					} else {
+						s = q + s + q
+					}
+					out = append(out, s)
+				}
+			}
+			return strings.Join(out, " ")
+		}
+	}
+	included := make(map[string]int) // include calls in progress, by name
+	execute := func(tmpl *template.Template, name string, data interface{}) (string, error) {
+		var b bytes.Buffer
+		err := tmpl.ExecuteTemplate(&b, name, data)
+		return b.String(), err
+	}
+
+	impl := template.FuncMap{
+		// Helm
+		"include": func(name string, data interface{}) (string, error) {
+			// Helm stops runaway recursion the same way
+			if included[name] >= maxIncludeDepth {
+				return "", fmt.Errorf("rendering template has a nested reference name: %s", name)
+			}
+			included[name]++
+			defer func() { included[name]-- }()
+			return execute(t, name, data)
+		},
+		"tpl": func(text string, data interface{}) (string, error) {
+			c, err := t.Clone()
+			if err != nil {
+				return "", err
+			}
+			if _, err := c.New("tpl").Parse(text); err != nil {
+				return "", err
+			}
+			return execute(c, "tpl", data)
+		},
+		"required": func(msg string, v interface{}) (interface{}, error) {
+			if v == nil || (reflect.TypeOf(v).Kind() == reflect.String && v.(string) == "") {
+				return nil, fmt.Errorf("%s", msg)
+			}
+			return v, nil
+		},
+		"fail": func(msg string) (string, error) {
+			return "", fmt.Errorf("%s", msg)
+		},
+		"toYaml": func(v interface{}) string {
+			var b bytes.Buffer
+			enc := yaml.NewEncoder(&b)
+			enc.SetIndent(2)
+			if err := enc.Encode(v); err != nil {
+				return ""
+			}
+			return strings.TrimSuffix(b.String(), "\n")
+		},
+		"fromYaml": func(s string) map[string]interface{} {
+			m := map[string]interface{}{}
+			if err := yaml.Unmarshal([]byte(s), &m); err != nil {
+				m["Error"] = err.Error()
+			}
+			return m
+		},
+		"toJson": func(v interface{}) string {
+			b, _ := json.Marshal(v)
+			return string(b)
+		},
+		"lookup": func(...interface{}) map[string]interface{} { return map[string]interface{}{} },
+
+		// Strings
+		"indent":     indent,
+		"nindent":    func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+		"trim":       strings.TrimSpace,
+		"trimAll":    func(cut, s string) string { return strings.Trim(s, cut) },
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"nospace":    func(s string) string { return strings.Join(strings.Fields(s), "") },
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"quote":      quote(`"`),
+		"squote":     quote("'"),
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":   func(sub, s string) bool { return strings.Contains(s, sub) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"repeat":     func(n int, s string) string { return strings.Repeat(s, n) },
+		"trunc": func(n int, s string) string {
+			if n < 0 && len(s)+n > 0 {
+				return s[len(s)+n:]
+			}
+			if n >= 0 && len(s) > n {
+				return s[:n]
+			}
+			return s
+		},
+		"cat": func(args ...interface{}) string {
+			var out []string
+			for _, arg := range args {
+				if arg != nil {
+					out = append(out, toString(arg))
+				}
+			}
+			return strings.Join(out, " ")
+		},
+		"toString":  toString,
+		"b64enc":    func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"join":      func(sep string, v interface{}) string { return strings.Join(toStrings(v), sep) },
+		"splitList": func(sep, s string) []string { return strings.Split(s, sep) },
+
+		// Defaults and flow
+		"default": func(d interface{}, given ...interface{}) interface{} {
+			if len(given) == 0 || isEmpty(given[0]) {
+				return d
+			}
+			return given[0]
+		},
+		"empty": isEmpty,
+		"coalesce": func(args ...interface{}) interface{} {
+			for _, arg := range args {
+				if !isEmpty(arg) {
+					return arg
+				}
+			}
+			return nil
+		},
+		"ternary": func(yes, no interface{}, cond bool) interface{} {
+			if cond {
+				return yes
+			}
+			return no
+		},
+
+		// Lists and dicts
+		"list": func(args ...interface{}) []interface{} { return args },
+		"append": func(list interface{}, v interface{}) []interface{} {
+			return append(toList(list), v)
+		},
+		"first": func(list interface{}) interface{} {
+			if l := toList(list); len(l) > 0 {
+				return l[0]
+			}
+			return nil
+		},
+		"last": func(list interface{}) interface{} {
+			if l := toList(list); len(l) > 0 {
+				return l[len(l)-1]
+			}
+			return nil
+		},
+		"dict": func(args ...interface{}) map[string]interface{} {
+			d := make(map[string]interface{}, len(args)/2)
+			for i := 0; i < len(args); i += 2 {
+				var v interface{}
+				if i+1 < len(args) {
+					v = args[i+1]
+				}
+				d[toString(args[i])] = v
+			}
+			return d
+		},
+		"get": func(d map[string]interface{}, key string) interface{} {
+			if v, ok := d[key]; ok {
+				return v
+			}
+			return ""
+		},
+		"set": func(d map[string]interface{}, key string, v interface{}) map[string]interface{} {
+			d[key] = v
+			return d
+		},
+		"unset": func(d map[string]interface{}, key string) map[string]interface{} {
+			delete(d, key)
+			return d
+		},
+		"hasKey": func(d map[string]interface{}, key string) bool {
+			_, ok := d[key]
+			return ok
+		},
+		"keys": func(dicts ...map[string]interface{}) []string {
+			var keys []string
+			for _, d := range dicts {
+				for k := range d {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			return keys
+		},
+
+		// Numbers
+		"int":   func(v interface{}) int { return int(toInt64(v)) },
+		"int64": toInt64,
+		"add": func(args ...interface{}) int64 {
+			var sum int64
+			for _, arg := range args {
+				sum += toInt64(arg)
+			}
+			return sum
+		},
+		"sub": func(a, b interface{}) int64 { return toInt64(a) - toInt64(b) },
+		"mul": func(a interface{}, args ...interface{}) int64 {
+			product := toInt64(a)
+			for _, arg := range args {
+				product *= toInt64(arg)
+			}
+			return product
+		},
+		"div": func(a, b interface{}) int64 { return toInt64(a) / toInt64(b) },
+		"mod": func(a, b interface{}) int64 { return toInt64(a) % toInt64(b) },
+	}
+	for name, fn := range impl {
+		f[name] = fn
+	}
+	return f
+}
+
+// placeholder returns a stand-in for a function without a real
+// implementation: it returns its name and arguments, so that both renders of
+// a comparison get the same value.
+func placeholder(name string) func(...interface{}) string {
+	return func(args ...interface{}) string {
+		return fmt.Sprintf("%s%v", name, args)
+	}
+}
+
+// toString converts a value to a string the way sprig does.
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// toStrings converts a list to strings, dropping nils.
+func toStrings(v interface{}) []string {
+	var out []string
+	for _, item := range toList(v) {
+		if item != nil {
+			out = append(out, toString(item))
+		}
+	}
+	return out
+}
+
+// toList converts a slice or array to a list; any other value is a list of
+// itself.
+func toList(v interface{}) []interface{} {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{v}
+	}
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list
+}
+
+// toInt64 converts numbers, booleans and numeric strings; anything else is 0.
+func toInt64(v interface{}) int64 {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return int64(rv.Float())
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1
+		}
+	case reflect.String:
+		if n, err := strconv.ParseInt(strings.TrimSpace(rv.String()), 0, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64); err == nil {
+			return int64(f)
+		}
+	}
+	return 0
+}
+
+// isEmpty reports whether a value is empty the way sprig's empty does.
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Complex64, reflect.Complex128:
+		return rv.Complex() == 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return rv.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package helmfmt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	helpers := []byte(`{{- define "app.labels" -}}
+app: {{ .Chart.Name }}
+{{- if .Values.tier }}
+tier: {{ .Values.tier | quote }}
+{{- end }}
+{{- end }}
+`)
+	opts := VerifyOptions{
+		Templates: map[string][]byte{"templates/_helpers.tpl": helpers},
+		Values: map[string]interface{}{
+			"tier":      "front",
+			"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": "1"}},
+		},
+		Chart: map[string]interface{}{"Name": "app"},
+	}
+
+	tests := []struct {
+		name       string
+		file       string
+		src        string
+		formatted  string
+		whitespace bool
+		err        string // expected error, "" for none
+	}{
+		{
+			name: "formatting",
+			file: "templates/deployment.yaml",
+			src: `metadata:
+  labels:
+    {{- include "app.labels" . | nindent 4 }}
+spec:
+{{- with .Values.resources }}
+{{- if .limits }}
+  resources:
+{{- toYaml . | nindent 4 }}
+{{- end }}
+{{- end }}
+`,
+			formatted: `metadata:
+  labels:
+    {{- include "app.labels" . | nindent 4 }}
+spec:
+{{- with .Values.resources }}
+  {{- if .limits }}
+  resources:
+    {{- toYaml . | nindent 4 }}
+  {{- end }}
+{{- end }}
+`,
+		},
+		{
+			name:      "whitespace reaching the output",
+			file:      "templates/deployment.yaml",
+			src:       "{{- if .Values.tier }}\n{{ .Values.tier }}\n{{- end }}\n",
+			formatted: "{{- if .Values.tier }}\n  {{ .Values.tier }}\n{{- end }}\n",
+			err:       `rendered output differs: line 2 was "front", is now "  front"`,
+		},
+		{
+			name:       "trailing whitespace, normalized",
+			file:       "templates/deployment.yaml",
+			src:        "a: 1\n{{- if .Values.tier }}\nb: 2\n{{- end }}\n",
+			formatted:  "a: 1\n{{- if .Values.tier }}  \nb: 2\n{{- end }}\n",
+			whitespace: true,
+		},
+		{
+			name:      "trailing whitespace, exact",
+			file:      "templates/deployment.yaml",
+			src:       "a: 1\n{{- if .Values.tier }}\nb: 2\n{{- end }}\n",
+			formatted: "a: 1\n{{- if .Values.tier }}  \nb: 2\n{{- end }}\n",
+			err:       `line 1 was "a: 1", is now "a: 1  "`,
+		},
+		{
+			name:      "helper",
+			file:      "templates/_helpers.tpl",
+			src:       string(helpers),
+			formatted: strings.Replace(string(helpers), "{{- if", "  {{ if", 1),
+			err:       `rendered output of "app.labels" differs`,
+		},
+		{
+			name:      "same render error",
+			file:      "templates/secret.yaml",
+			src:       "{{- if .Values.tier }}\n{{- required \"password is required\" .Values.password }}\n{{- end }}\n",
+			formatted: "{{- if .Values.tier }}\n  {{- required \"password is required\" .Values.password }}\n{{- end }}\n",
+		},
+		{
+			name:      "recursive include",
+			file:      "templates/loop.yaml",
+			src:       "{{- define \"loop\" }}{{ include \"loop\" . }}{{ end }}\n{{- if .Values.tier }}\n{{- include \"loop\" . }}\n{{- end }}\n",
+			formatted: "{{- define \"loop\" }}{{ include \"loop\" . }}{{ end }}\n{{- if .Values.tier }}\n  {{- include \"loop\" . }}\n{{- end }}\n",
+		},
+		{
+			name:      "define renamed",
+			file:      "templates/_helpers.tpl",
+			src:       string(helpers),
+			formatted: strings.Replace(string(helpers), `"app.labels"`, `"app.label"`, 1),
+			err:       `define "app.labels" is missing after formatting`,
+		},
+		{
+			name:      "define added",
+			file:      "templates/deployment.yaml",
+			src:       "a: 1\n",
+			formatted: "a: 1\n{{- define \"extra\" }}{{ end }}\n",
+			err:       `define "extra" appears only after formatting`,
+		},
+		{
+			name:      "values changed by the template",
+			file:      "templates/set.yaml",
+			src:       "{{- if .Values.tier }}\ntier: {{ .Values.tier }}\n{{- $_ := set .Values \"tier\" \"back\" }}\n{{- $_ := unset .Chart \"Name\" }}\n{{- end }}\n",
+			formatted: "{{- if .Values.tier }}\ntier: {{ .Values.tier }}\n  {{- $_ := set .Values \"tier\" \"back\" }}\n  {{- $_ := unset .Chart \"Name\" }}\n{{- end }}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := opts
+			opts.Whitespace = tt.whitespace
+			err := Verify(tt.file, []byte(tt.src), []byte(tt.formatted), opts)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+	if opts.Values["tier"] != "front" || opts.Chart["Name"] != "app" {
+		t.Errorf("values changed by a render: %v, %v", opts.Values, opts.Chart)
+	}
+}
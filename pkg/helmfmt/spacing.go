@@ -0,0 +1,173 @@
+package helmfmt
+
+import "strings"
+
+type spacingRules struct {
+	delimiters, assignment, pipe bool
+}
+
+func (r spacingRules) any() bool {
+	return r.delimiters || r.assignment || r.pipe
+}
+
+// withDirectives applies the disable/enable directives in scope at tokens[k].
+func (r spacingRules) withDirectives(d *directives, k int) spacingRules {
+	return spacingRules{
+		delimiters: !d.ruleDisabled(k, SpacingDelimiters, !r.delimiters),
+		assignment: !d.ruleDisabled(k, SpacingAssignment, !r.assignment),
+		pipe:       !d.ruleDisabled(k, SpacingPipe, !r.pipe),
+	}
+}
+
+// enabledSpacingRules returns which spacing rules apply to filePath.
+func enabledSpacingRules(config *Config, filePath string) spacingRules {
+	enabled := func(name string) bool {
+		rule, ok := config.Rules.Spacing[name]
+		return ok && !rule.Disabled && !matchesExcludePattern(filePath, rule.Exclude)
+	}
+	return spacingRules{
+		delimiters: enabled(SpacingDelimiters),
+		assignment: enabled(SpacingAssignment),
+		pipe:       enabled(SpacingPipe),
+	}
+}
+
+// formatSpacing normalizes whitespace inside every action of src according to
+// the enabled spacing rules. Text, comments and string literals are kept
+// verbatim, and whitespace containing a newline is never collapsed, so the
+// line structure of the file is preserved. Actions on lines protected by
+// helmfmt directives are kept verbatim too.
+func formatSpacing(src string, config *Config, filePath string) string {
+	rules := enabledSpacingRules(config, filePath)
+	if !rules.any() && !strings.Contains(src, "helmfmt:") {
+		return src
+	}
+
+	tokens := lexTemplate(src)
+	starts := lineOffsets(strings.Split(src, "\n"))
+	dirs := analyzeDirectives(src, tokens, starts)
+
+	var b strings.Builder
+	b.Grow(len(src))
+	for k, tok := range tokens {
+		if tok.typ != tokAction || dirs.preserved[lineIndex(starts, tok.pos)] {
+			b.WriteString(src[tok.pos:tok.end])
+			continue
+		}
+		b.WriteString(formatActionSpacing(src, tok, rules.withDirectives(dirs, k)))
+	}
+	return b.String()
+}
+
+// formatActionSpacing returns the source of a single action with its spacing
+// normalized.
+func formatActionSpacing(src string, tok token, rules spacingRules) string {
+	bodyStart := tok.pos + len(leftDelim)
+	if tok.leftTrim {
+		bodyStart += 2
+	}
+	bodyEnd := bodyStart + len(tok.body)
+	open, body, close := src[tok.pos:bodyStart], tok.body, src[bodyEnd:tok.end]
+
+	if rules.assignment || rules.pipe {
+		body = spaceOperators(body, rules)
+	}
+	if !rules.delimiters || strings.TrimSpace(body) == "" {
+		return open + body + close
+	}
+
+	// A '-' glued to a delimiter is a trim marker missing its space, unless it
+	// is the sign of a number as in {{-3}}.
+	leftTrim, rightTrim := tok.leftTrim, tok.rightTrim
+	if !leftTrim && len(body) > 1 && body[0] == trimMarker && !startsNumber(body[1:]) {
+		leftTrim = true
+		body = body[1:]
+	}
+	if !rightTrim && len(body) > 1 && body[len(body)-1] == trimMarker {
+		rightTrim = true
+		body = body[:len(body)-1]
+	}
+
+	inner := strings.TrimLeft(body, " \t\r\n")
+	if lead := body[:len(body)-len(inner)]; strings.Contains(open+lead, "\n") {
+		inner = body
+	} else if leftTrim {
+		open = "{{- "
+	} else {
+		open = "{{ "
+	}
+	trimmed := strings.TrimRight(inner, " \t\r\n")
+	if trail := inner[len(trimmed):]; strings.Contains(trail+close, "\n") {
+		trimmed = inner
+	} else if rightTrim {
+		close = " -}}"
+	} else {
+		close = " }}"
+	}
+	return open + trimmed + close
+}
+
+// spaceOperators puts exactly one space around assignment operators and pipes
+// in an action body. Whitespace that spans lines is left alone.
+func spaceOperators(body string, rules spacingRules) string {
+	out := make([]byte, 0, len(body)+8)
+	for i := 0; i < len(body); {
+		c := body[i]
+		var op string
+		switch {
+		case c == '"' || c == '\'':
+			j := skipQuoted(body, i)
+			out = append(out, body[i:j]...)
+			i = j
+			continue
+		case c == '`':
+			j := len(body)
+			if x := strings.IndexByte(body[i+1:], '`'); x >= 0 {
+				j = i + x + 2
+			}
+			out = append(out, body[i:j]...)
+			i = j
+			continue
+		case rules.assignment && strings.HasPrefix(body[i:], ":="):
+			op = ":="
+		case rules.assignment && c == '=':
+			op = "="
+		case rules.pipe && c == '|':
+			op = "|"
+		default:
+			out = append(out, c)
+			i++
+			continue
+		}
+
+		// Before the operator: collapse spaces, unless it starts a line
+		trimmed := strings.TrimRight(string(out), " \t")
+		if len(trimmed) > 0 && trimmed[len(trimmed)-1] != '\n' {
+			out = append([]byte(trimmed), ' ')
+		}
+		out = append(out, op...)
+		i += len(op)
+
+		// After the operator: collapse spaces, unless it ends a line
+		j := i
+		for j < len(body) && (body[j] == ' ' || body[j] == '\t') {
+			j++
+		}
+		if j < len(body) && body[j] != '\n' && body[j] != '\r' {
+			out = append(out, ' ')
+		}
+		i = j
+	}
+	return string(out)
+}
+
+// startsNumber reports whether s begins like a numeric constant.
+func startsNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	if s[0] >= '0' && s[0] <= '9' {
+		return true
+	}
+	return s[0] == '.' && len(s) > 1 && s[1] >= '0' && s[1] <= '9'
+}
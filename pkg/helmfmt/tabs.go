@@ -0,0 +1,78 @@
+package helmfmt
+
+import "strings"
+
+// defaultTabWidth is the width of a tab when Config.TabWidth isn't set.
+const defaultTabWidth = 8
+
+func (c *Config) tabWidth() int {
+	if c.TabWidth > 0 {
+		return c.TabWidth
+	}
+	return defaultTabWidth
+}
+
+// indentOf returns the indentation of nesting level n.
+func (c *Config) indentOf(n int) string {
+	if c.IndentStyle == IndentStyleTab {
+		return strings.Repeat("\t", n)
+	}
+	return strings.Repeat(" ", n*c.IndentSize)
+}
+
+// width returns how many columns s takes, tabs advancing to the next tab stop.
+func (c *Config) width(s string) int {
+	return advance(0, s, c.tabWidth())
+}
+
+// whitespace returns indentation n columns wide in the indent style: tabs,
+// then spaces for the rest, or only spaces.
+func (c *Config) whitespace(n int) string {
+	if c.IndentStyle == IndentStyleTab {
+		tw := c.tabWidth()
+		return strings.Repeat("\t", n/tw) + strings.Repeat(" ", n%tw)
+	}
+	return strings.Repeat(" ", n)
+}
+
+// alignTo returns indentation reaching column n that starts with indent when
+// it is narrower: tabs for the indentation, spaces for the alignment.
+func (c *Config) alignTo(indent string, n int) string {
+	if w := c.width(indent); w <= n {
+		return indent + strings.Repeat(" ", n-w)
+	}
+	return c.whitespace(n)
+}
+
+// advance returns the column reached by writing s from column col.
+func advance(col int, s string, tabWidth int) int {
+	for _, r := range s {
+		if r == '\t' {
+			col = (col/tabWidth + 1) * tabWidth
+		} else {
+			col++
+		}
+	}
+	return col
+}
+
+// tabNotes returns a note for each text line indented with a tab, which YAML
+// doesn't allow. Lines starting with a tag, or inside one, are left to
+// formatting.
+func tabNotes(tokens []token, lines []string, starts []int) []Note {
+	var notes []Note
+	k := 0
+	for i, line := range lines {
+		n := leadingWhitespace(line)
+		if !strings.Contains(line[:n], "\t") || n == len(strings.TrimRight(line, "\r")) {
+			continue
+		}
+		for k < len(tokens) && tokens[k].end <= starts[i] {
+			k++
+		}
+		if k < len(tokens) && tokens[k].typ == tokText && tokens[k].end > starts[i]+n {
+			notes = append(notes, Note{Line: i + 1, Rule: NoteTabs, Message: "indented with a tab, which YAML forbids"})
+		}
+	}
+	return notes
+}
@@ -0,0 +1,98 @@
+package helmfmt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndentStyle(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(*Config)
+		src      string
+		expected string
+	}{
+		{
+			name:  "tabs",
+			setup: func(c *Config) { c.IndentStyle = IndentStyleTab },
+			src: `{{- if .Values.a }}
+{{- with .Values.b }}
+{{- $x := 1 }}
+  {{- end }}
+{{- end }}
+`,
+			expected: "{{- if .Values.a }}\n\t{{- with .Values.b }}\n\t\t{{- $x := 1 }}\n\t{{- end }}\n{{- end }}\n",
+		},
+		{
+			name:  "tab-indented comment body",
+			setup: func(c *Config) {},
+			src:   "{{- if .Values.a }}\n{{- /*\n\texample:\n\t  key: v\n*/}}\n{{- end }}\n",
+			expected: `{{- if .Values.a }}
+  {{- /*
+          example:
+            key: v
+  */}}
+{{- end }}
+`,
+		},
+		{
+			name:     "comment body shifted in tabs",
+			setup:    func(c *Config) { c.IndentStyle = IndentStyleTab; c.TabWidth = 4 },
+			src:      "{{- if .Values.a }}\n{{- /*\n  example:\n      key: v\n*/}}\n{{- end }}\n",
+			expected: "{{- if .Values.a }}\n\t{{- /*\n\t  example:\n\t\t  key: v\n\t*/}}\n{{- end }}\n",
+		},
+		{
+			name:     "aligned continuation",
+			setup:    func(c *Config) { c.IndentStyle = IndentStyleTab; c.ContinuationIndent = ContinuationAlign },
+			src:      "{{- if .Values.a }}\n{{- $x := merge (dict \"a\" 1)\n(dict \"b\" 2) }}\n{{- end }}\n",
+			expected: "{{- if .Values.a }}\n\t{{- $x := merge (dict \"a\" 1)\n\t                (dict \"b\" 2) }}\n{{- end }}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			tt.setup(config)
+			got, err := Format([]byte(tt.src), Options{Config: config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("expected:\n%q\ngot:\n%q", tt.expected, got)
+			}
+			if again, err := Format(got, Options{Config: config}); err != nil || string(again) != string(got) {
+				t.Errorf("second pass: got %q, %v", again, err)
+			}
+		})
+	}
+
+	config := DefaultConfig()
+	config.IndentStyle = "mixed"
+	if _, err := Format([]byte("a: 1\n"), Options{Config: config}); err == nil {
+		t.Error("expected an unknown indent style to be rejected")
+	}
+}
+
+func TestWarnTabs(t *testing.T) {
+	src := "a:\n\tb: 1\n{{- if .Values.a }}\n\t{{- $x := 1 }}\nc: \"\td\"\n  \te: 2\n{{- end }}\n"
+	config := DefaultConfig()
+	config.WarnTabs = true
+	_, notes, err := FormatWithNotes([]byte(src), Options{Config: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []int
+	for _, n := range notes {
+		if n.Rule == NoteTabs {
+			lines = append(lines, n.Line)
+		}
+	}
+	if expected := []int{2, 6}; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected tab notes on lines %v, got %v", expected, lines)
+	}
+
+	config.WarnTabs = false
+	if _, notes, _ := FormatWithNotes([]byte(src), Options{Config: config}); len(notes) != 0 {
+		t.Errorf("expected no notes without warn_tabs, got %v", notes)
+	}
+}
@@ -0,0 +1,160 @@
+package helmfmt
+
+import (
+	"sort"
+	"strings"
+)
+
+// trimSpace holds the characters a trim marker removes, as in text/template.
+const trimSpace = " \t\r\n"
+
+type trimRules struct {
+	addLeft, dropRight bool
+}
+
+func (r trimRules) any() bool {
+	return r.addLeft || r.dropRight
+}
+
+// withDirectives applies the disable/enable directives in scope at tokens[k].
+func (r trimRules) withDirectives(d *directives, k int) trimRules {
+	return trimRules{
+		addLeft:   !d.ruleDisabled(k, TrimAddLeft, !r.addLeft),
+		dropRight: !d.ruleDisabled(k, TrimDropRight, !r.dropRight),
+	}
+}
+
+// enabledTrimRules returns which trim rules apply to filePath.
+func enabledTrimRules(config *Config, filePath string) trimRules {
+	enabled := func(name string) bool {
+		rule, ok := config.Rules.Trim[name]
+		return ok && !rule.Disabled && !matchesExcludePattern(filePath, rule.Exclude)
+	}
+	return trimRules{
+		addLeft:   enabled(TrimAddLeft),
+		dropRight: enabled(TrimDropRight),
+	}
+}
+
+// formatTrim moves the trim markers of standalone control tags (if, range,
+// with, define, else and end alone on their line) towards {{- ... }}, as the
+// enabled trim rules ask, with a note for each changed line.
+//
+// A marker is only added or dropped when the text next to the tag stays the
+// same once trimmed, which is all a trim marker affects: the rendered output
+// is then unchanged byte for byte. In practice this holds when a neighboring
+// tag already trims the same whitespace, e.g. the "\n" between
+// {{- if .X -}} and {{- include ... }}.
+func formatTrim(src string, config *Config, filePath string) (string, []Note) {
+	rules := enabledTrimRules(config, filePath)
+	if !rules.any() && !strings.Contains(src, "helmfmt:") {
+		return src, nil
+	}
+
+	tokens := lexTemplate(src)
+	applyParseTree(src, tokens)
+	starts := lineOffsets(strings.Split(src, "\n"))
+	dirs := analyzeDirectives(src, tokens, starts)
+
+	// Trim markers as they were and as they are becoming. A change must keep
+	// the text the same against both, so that any subset of the changes,
+	// such as the one kept by Options.Lines, renders the same too.
+	type trims struct{ left, right bool }
+	orig := make([]trims, len(tokens))
+	cur := make([]trims, len(tokens))
+	for k, tok := range tokens {
+		orig[k] = trims{tok.leftTrim, tok.rightTrim}
+	}
+	copy(cur, orig)
+
+	// textKept reports whether the text token j, if any, trims to the same
+	// string when the tag before it right-trims per before and the one after
+	// it left-trims per after, as with the markers in state.
+	textKept := func(j int, state []trims, before, after bool) bool {
+		if j < 0 || j >= len(tokens) || tokens[j].typ != tokText {
+			return true
+		}
+		was := trimText(src[tokens[j].pos:tokens[j].end], j > 0 && state[j-1].right, j+1 < len(tokens) && state[j+1].left)
+		is := trimText(src[tokens[j].pos:tokens[j].end], before, after)
+		return was == is
+	}
+
+	var notes []Note
+	for k, tok := range tokens {
+		if tok.typ != tokAction || writesOutput(tok) || tok.kind == tokVar || !standalone(src, tok) {
+			continue
+		}
+		line := lineIndex(starts, tok.pos)
+		if dirs.preserved[line] {
+			continue
+		}
+		r := rules.withDirectives(dirs, k)
+		if r.addLeft && !cur[k].left {
+			prev := k - 1
+			if textKept(prev, orig, prev > 0 && orig[prev-1].right, true) &&
+				textKept(prev, cur, prev > 0 && cur[prev-1].right, true) {
+				cur[k].left = true
+				notes = append(notes, Note{Line: line + 1, Rule: NoteTrim, Message: "added {{-: the whitespace it trims was already trimmed"})
+			}
+		}
+		if r.dropRight && cur[k].right {
+			next := k + 1
+			if textKept(next, orig, false, next+1 < len(tokens) && orig[next+1].left) &&
+				textKept(next, cur, false, next+1 < len(tokens) && cur[next+1].left) {
+				cur[k].right = false
+				notes = append(notes, Note{Line: lineIndex(starts, tok.end-1) + 1, Rule: NoteTrim, Message: "dropped -}}: the whitespace it trims is trimmed anyway"})
+			}
+		}
+	}
+	if len(notes) == 0 {
+		return src, nil
+	}
+
+	var b strings.Builder
+	b.Grow(len(src) + len(notes)*2)
+	for k, tok := range tokens {
+		s := src[tok.pos:tok.end]
+		if cur[k].left && !orig[k].left {
+			if rest := s[len(leftDelim):]; rest != "" && strings.ContainsRune(trimSpace, rune(rest[0])) {
+				s = leftDelim + "-" + rest
+			} else {
+				s = leftDelim + "- " + rest
+			}
+		}
+		if !cur[k].right && orig[k].right {
+			s = s[:len(s)-len(rightDelim)-1] + rightDelim
+		}
+		b.WriteString(s)
+	}
+	return b.String(), notes
+}
+
+// trimText returns text as it is written to the output when the tags around
+// it trim it at the start and at the end.
+func trimText(text string, start, end bool) string {
+	if start {
+		text = strings.TrimLeft(text, trimSpace)
+	}
+	if end {
+		text = strings.TrimRight(text, trimSpace)
+	}
+	return text
+}
+
+// standalone reports whether tok is alone on its line(s), with nothing but
+// spaces and tabs around it.
+func standalone(src string, tok token) bool {
+	before := src[strings.LastIndexByte(src[:tok.pos], '\n')+1 : tok.pos]
+	after := src[tok.end:]
+	if i := strings.IndexByte(after, '\n'); i >= 0 {
+		after = after[:i]
+	}
+	return strings.Trim(before, " \t") == "" && strings.Trim(after, " \t\r") == ""
+}
+
+// sortNotes orders notes by line, keeping the order of notes about the same
+// line.
+func sortNotes(notes []Note) []Note {
+	sort.SliceStable(notes, func(i, j int) bool { return notes[i].Line < notes[j].Line })
+	return notes
+}
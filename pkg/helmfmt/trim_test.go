@@ -0,0 +1,123 @@
+package helmfmt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrimRules(t *testing.T) {
+	values := map[string]interface{}{"x": true, "y": true, "z": false}
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+		notes    []int // lines with a note
+	}{
+		{
+			name: "markers trimming the same whitespace",
+			src: `{{- define "x" -}}
+{{ if .Values.x -}}
+{{- include "y" . }}
+{{ end -}}
+{{- end }}
+{{- define "y" }}y{{ end }}
+a: {{ include "x" . }}
+`,
+			expected: `{{- define "x" -}}
+  {{- if .Values.x }}
+{{- include "y" . }}
+{{ end }}
+{{- end }}
+{{- define "y" }}y{{ end }}
+a: {{ include "x" . }}
+`,
+			notes: []int{2, 2, 4},
+		},
+		{
+			name: "whitespace reaching the output",
+			src: `a:
+{{- if .Values.y -}}
+  b: 1
+{{ end }}
+c: 2
+`,
+			expected: `a:
+{{- if .Values.y -}}
+  b: 1
+{{ end }}
+c: 2
+`,
+		},
+		{
+			name: "tags sharing a line with text",
+			src: `a: {{ if .Values.y -}}
+{{- end }}
+{{ if .Values.z -}} b {{- end }}
+`,
+			expected: `a: {{ if .Values.y -}}
+{{- end }}
+{{ if .Values.z -}} b {{- end }}
+`,
+		},
+		{
+			name: "directive wins",
+			src: `{{- if .Values.x -}}
+{{- /* helmfmt:disable=add_left */}}
+{{ if .Values.z -}}
+{{ else -}}
+{{- end }}
+{{- end }}
+`,
+			expected: `{{- if .Values.x }}
+  {{- /* helmfmt:disable=add_left */}}
+{{ if .Values.z -}}
+  {{ else }}
+  {{- end }}
+{{- end }}
+`,
+			notes: []int{1, 4},
+		},
+	}
+
+	// Leave lines whose indentation reaches the output alone, so that only
+	// the trim rules could change the rendered output
+	config := DefaultConfig()
+	config.LeadingWhitespace = LeadingWhitespaceSkip
+	for _, name := range []string{TrimAddLeft, TrimDropRight} {
+		config.Rules.Trim[name] = RuleConfig{}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, notes, err := FormatWithNotes([]byte(tt.src), Options{Config: config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+			var lines []int
+			for _, n := range notes {
+				if n.Rule == NoteTrim {
+					lines = append(lines, n.Line)
+				}
+			}
+			if !reflect.DeepEqual(lines, tt.notes) {
+				t.Errorf("expected notes on lines %v, got %+v", tt.notes, notes)
+			}
+			if err := Verify("t.yaml", []byte(tt.src), got, VerifyOptions{Values: values}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// Disabled by default
+	_, notes, err := FormatWithNotes([]byte(tests[0].src), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range notes {
+		if n.Rule == NoteTrim {
+			t.Errorf("expected no change by default, got %+v", n)
+		}
+	}
+}
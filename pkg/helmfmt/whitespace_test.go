@@ -0,0 +1,114 @@
+package helmfmt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLeadingWhitespace(t *testing.T) {
+	src := `a:
+{{ if .X }}
+{{ if .Y }}
+b: 1
+{{ printf "x" }}
+{{ end }}
+{{- $a := 1 }}
+{{ if .Z -}}
+{{ .Z }}
+{{ end }}
+{{ end }}
+`
+	tests := []struct {
+		mode     string
+		expected string
+		notes    []int // lines with a note
+	}{
+		{
+			mode: LeadingWhitespaceIndent,
+			expected: `a:
+{{ if .X }}
+  {{ if .Y }}
+b: 1
+    {{ printf "x" }}
+  {{ end }}
+  {{- $a := 1 }}
+  {{ if .Z -}}
+{{ .Z }}
+  {{ end }}
+{{ end }}
+`,
+			notes: []int{5, 8},
+		},
+		{
+			mode: LeadingWhitespaceSkip,
+			expected: `a:
+{{ if .X }}
+{{ if .Y }}
+b: 1
+{{ printf "x" }}
+{{ end }}
+  {{- $a := 1 }}
+{{ if .Z -}}
+{{ .Z }}
+{{ end }}
+{{ end }}
+`,
+			notes: []int{3, 5, 6, 8, 10},
+		},
+		{
+			mode: LeadingWhitespaceTrim,
+			expected: `a:
+{{ if .X }}
+  {{- if .Y }}
+b: 1
+{{ printf "x" }}
+  {{- end }}
+  {{- $a := 1 }}
+  {{- if .Z -}}
+{{ .Z }}
+  {{- end }}
+{{ end }}
+`,
+			notes: []int{3, 5, 6, 8, 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			config := DefaultConfig()
+			config.LeadingWhitespace = tt.mode
+			got, notes, err := FormatWithNotes([]byte(src), Options{Config: config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+			var lines []int
+			for _, n := range notes {
+				lines = append(lines, n.Line)
+			}
+			if !reflect.DeepEqual(lines, tt.notes) {
+				t.Errorf("expected notes on lines %v, got %+v", tt.notes, notes)
+			}
+
+			// Formatting again changes nothing, and in indent mode has nothing to say
+			again, notes, err := FormatWithNotes(got, Options{Config: config})
+			if err != nil || string(again) != string(got) || (tt.mode == LeadingWhitespaceIndent && len(notes) != 0) {
+				t.Errorf("second pass: got %q, %+v, %v", again, notes, err)
+			}
+		})
+	}
+
+	// Only the notes of the selected lines are returned
+	_, notes, err := FormatWithNotes([]byte(src), Options{Lines: []LineRange{{Start: 6, End: 8}}})
+	if err != nil || len(notes) != 1 || notes[0].Line != 8 {
+		t.Errorf("expected a note on line 8, got %+v, %v", notes, err)
+	}
+
+	config := DefaultConfig()
+	config.LeadingWhitespace = "strip"
+	if _, err := Format([]byte(src), Options{Config: config}); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+}
@@ -0,0 +1,274 @@
+package helmfmt
+
+import "strings"
+
+// wrapRule is the name under which helmfmt directives turn wrapping off, as
+// in {{/* helmfmt: disable=max_line_length */}}.
+const wrapRule = "max_line_length"
+
+// wrapLongActions splits the actions that start a line longer than
+// config.MaxLineLength across several lines: before each "|" of the
+// pipeline, then between arguments, breaking inside parentheses when an
+// argument doesn't fit on a line of its own. Continuation lines are then
+// indented as formatIndentation does it, see layoutContinuation.
+//
+// Only single-line actions are wrapped, and with ranges, only those on the
+// selected lines.
+func wrapLongActions(src string, config *Config, ranges []LineRange) string {
+	if config.MaxLineLength <= 0 {
+		return src
+	}
+	tokens := lexTemplate(src)
+	lines := strings.Split(src, "\n")
+	starts := lineOffsets(lines)
+	dirs := analyzeDirectives(src, tokens, starts)
+
+	var out []string
+	next := 0
+	for i, line := range lines {
+		for next < len(tokens) && tokens[next].pos < starts[i] {
+			next++
+		}
+		k := tagAt(tokens, next, starts[i]+leadingWhitespace(line))
+		if k < 0 || tokens[k].typ != tokAction || dirs.preserved[i] || !inRanges(ranges, i+1) ||
+			config.width(line) <= config.MaxLineLength ||
+			dirs.ruleDisabled(k, wrapRule, false) {
+			out = append(out, line)
+			continue
+		}
+		tok := tokens[k]
+		if strings.Contains(src[tok.pos:tok.end], "\n") || strings.TrimSpace(tok.body) == "" {
+			out = append(out, line)
+			continue
+		}
+
+		indent := line[:leadingWhitespace(line)]
+		head := indent + leftDelim
+		tail := " " + rightDelim
+		if tok.leftTrim {
+			head += "-"
+		}
+		if tok.rightTrim {
+			tail = " -" + rightDelim
+		}
+		tail += line[tok.end-starts[i]:]
+		w := &wrapper{
+			config: config,
+			cont:   indent + config.indentOf(1),
+			cur:    head,
+		}
+		w.pipeline(fieldsOf(strings.TrimSpace(tok.body)), tail)
+		wrapped := w.done()
+		layoutContinuation(wrapped, len(indent), indent, config)
+		out = append(out, wrapped...)
+	}
+	return strings.Join(out, "\n")
+}
+
+// inRanges reports whether line is in one of ranges, or ranges is empty.
+func inRanges(ranges []LineRange, line int) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, r := range ranges {
+		if line >= r.Start && line <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapper lays out the words of an action over lines of a given width.
+type wrapper struct {
+	config *Config // MaxLineLength is the width, measured with tabs expanded
+	cont   string  // indentation of continuation lines
+	lines  []string
+	cur    string // line being filled
+}
+
+func (w *wrapper) done() []string {
+	return append(w.lines, w.cur)
+}
+
+// fresh reports whether nothing was put on the current continuation line yet.
+func (w *wrapper) fresh() bool {
+	return w.cur == w.cont
+}
+
+func (w *wrapper) fits(word string) bool {
+	return w.config.width(w.cur+" "+word) <= w.config.MaxLineLength
+}
+
+func (w *wrapper) add(word string) {
+	if !w.fresh() {
+		w.cur += " "
+	}
+	w.cur += word
+}
+
+func (w *wrapper) newline() {
+	w.lines = append(w.lines, w.cur)
+	w.cur = w.cont
+}
+
+// pipeline places the words of a pipeline, starting a line before each of
+// its "|", followed by tail.
+func (w *wrapper) pipeline(words []string, tail string) {
+	var commands [][]string
+	start := 0
+	for n, word := range words {
+		if word == "|" {
+			commands = append(commands, words[start:n])
+			start = n
+		}
+	}
+	commands = append(commands, words[start:])
+
+	for c, command := range commands {
+		command = gluePipes(command)
+		if c > 0 {
+			w.newline()
+		}
+		if c == len(commands)-1 {
+			command = append([]string(nil), command...)
+			command[len(command)-1] += tail
+		}
+		w.command(command)
+	}
+}
+
+// gluePipes joins each "|" of words to the word after it, keeping a pipe
+// with the function it calls.
+func gluePipes(words []string) []string {
+	var glued []string
+	for n := 0; n < len(words); n++ {
+		if words[n] == "|" && n+1 < len(words) {
+			glued = append(glued, "| "+words[n+1])
+			n++
+			continue
+		}
+		glued = append(glued, words[n])
+	}
+	return glued
+}
+
+// command places the words of a command of the pipeline, breaking lines
+// between them as needed. The first two words of the command, and a
+// declaration with the word after it, stay on the same line.
+func (w *wrapper) command(words []string) {
+	keep := 2
+	for n, word := range words {
+		if word == ":=" || word == "=" {
+			keep = max(keep, n+2)
+		}
+	}
+	for n, word := range words {
+		w.place(word, n >= keep)
+	}
+}
+
+// place puts word on the current line, or on the next one if it doesn't fit
+// and breakable is set. A parenthesized word too long for a line of its own
+// is broken inside its parentheses.
+func (w *wrapper) place(word string, breakable bool) {
+	if w.fits(word) || w.fresh() && !strings.HasPrefix(word, "(") {
+		w.add(word)
+		return
+	}
+	if breakable && !w.fresh() && w.config.width(w.cont+word) <= w.config.MaxLineLength {
+		w.newline()
+		w.add(word)
+		return
+	}
+	inner, suffix, ok := parenthesized(word)
+	if !ok {
+		if breakable && !w.fresh() {
+			w.newline()
+		}
+		w.add(word)
+		return
+	}
+	fields := gluePipes(fieldsOf(inner))
+	fields[0] = "(" + fields[0]
+	fields[len(fields)-1] += ")" + suffix
+	if !w.fits(fields[0]) && breakable && !w.fresh() {
+		w.newline()
+	}
+	w.add(fields[0])
+	for n := 1; n < len(fields); n++ {
+		w.place(fields[n], true)
+	}
+}
+
+// parenthesized splits a word starting with "(" into what its parentheses
+// hold and what follows them, as in "(index .x 0).y".
+func parenthesized(word string) (string, string, bool) {
+	if !strings.HasPrefix(word, "(") {
+		return "", "", false
+	}
+	depth := 0
+	for i := 0; i < len(word); i++ {
+		switch word[i] {
+		case '"', '\'':
+			i = skipQuoted(word, i) - 1
+		case '`':
+			if x := strings.IndexByte(word[i+1:], '`'); x >= 0 {
+				i += x + 1
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				inner := strings.TrimSpace(word[1:i])
+				if inner == "" {
+					return "", "", false
+				}
+				return inner, word[i+1:], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// fieldsOf splits an action body, or the inside of parentheses, into its
+// words: at whitespace outside parentheses and literals. A "|" outside
+// parentheses is a word of its own, even when glued to its neighbors.
+func fieldsOf(s string) []string {
+	var fields []string
+	start, depth := -1, 0
+	flush := func(end int) {
+		if start >= 0 {
+			fields = append(fields, s[start:end])
+			start = -1
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if depth == 0 && isSpace(c) {
+			flush(i)
+			continue
+		}
+		if depth == 0 && c == '|' {
+			flush(i)
+			fields = append(fields, "|")
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		switch c {
+		case '"', '\'':
+			i = skipQuoted(s, i) - 1
+		case '`':
+			if x := strings.IndexByte(s[i+1:], '`'); x >= 0 {
+				i += x + 1
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+	}
+	flush(len(s))
+	return fields
+}
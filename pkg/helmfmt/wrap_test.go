@@ -0,0 +1,88 @@
+package helmfmt
+
+import "testing"
+
+func TestWrapLongActions(t *testing.T) {
+	values := map[string]interface{}{
+		"enabled": true,
+		"labels":  map[string]interface{}{"app": "web"},
+		"extra":   map[string]interface{}{"tier": "front"},
+	}
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name: "pipeline",
+			src: `{{- if .Values.enabled }}
+labels:
+  {{- toYaml (merge (dict "release" .Release.Name) .Values.labels .Values.extra) | nindent 2 }}
+{{- end }}
+`,
+			expected: `{{- if .Values.enabled }}
+labels:
+  {{- toYaml (merge (dict "release" .Release.Name) .Values.labels .Values.extra)
+    | nindent 2 }}
+{{- end }}
+`,
+		},
+		{
+			name: "arguments and parentheses",
+			src: `{{- $all := merge (dict "a" .Values.labels.app "b" .Values.extra.tier "c" .Release.Name "d" .Chart.Name) (dict "e" "f") }}
+all: {{ $all | toJson }}
+`,
+			expected: `{{- $all := merge (dict "a" .Values.labels.app "b" .Values.extra.tier "c"
+    .Release.Name "d" .Chart.Name) (dict "e" "f") }}
+all: {{ $all | toJson }}
+`,
+		},
+		{
+			name: "short enough",
+			src: `{{- $x := merge (dict "a" 1) (dict "b" 2) }}
+x: {{ $x | toJson }}
+`,
+			expected: `{{- $x := merge (dict "a" 1) (dict "b" 2) }}
+x: {{ $x | toJson }}
+`,
+		},
+		{
+			name: "directive",
+			src: `{{- /* helmfmt: disable=max_line_length */}}
+{{- $all := merge (dict "a" .Values.labels.app "b" .Values.extra.tier "c" .Release.Name "d" .Chart.Name) }}
+all: {{ $all | toJson }}
+`,
+			expected: `{{- /* helmfmt: disable=max_line_length */}}
+{{- $all := merge (dict "a" .Values.labels.app "b" .Values.extra.tier "c" .Release.Name "d" .Chart.Name) }}
+all: {{ $all | toJson }}
+`,
+		},
+	}
+
+	config := DefaultConfig()
+	config.MaxLineLength = 80
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format([]byte(tt.src), Options{Config: config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+			if err := Verify("t.yaml", []byte(tt.src), got, VerifyOptions{Values: values}); err != nil {
+				t.Error(err)
+			}
+			if again, err := Format(got, Options{Config: config}); err != nil || string(again) != string(got) {
+				t.Errorf("second pass: got %q, %v", again, err)
+			}
+		})
+	}
+
+	// With line ranges, only the selected lines are wrapped
+	src := tests[0].src
+	got, err := Format([]byte(src), Options{Config: config, Lines: []LineRange{{Start: 1, End: 2}}})
+	if err != nil || string(got) != src {
+		t.Errorf("expected line 3 to be left alone, got %q, %v", got, err)
+	}
+}
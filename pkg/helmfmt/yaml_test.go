@@ -0,0 +1,110 @@
+package helmfmt
+
+import "testing"
+
+func TestYAMLAware(t *testing.T) {
+	values := map[string]interface{}{
+		"enabled":   true,
+		"labels":    map[string]interface{}{"app": "web", "tier": "front"},
+		"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": "1"}},
+	}
+	tests := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name: "toYaml piped to nindent",
+			src: `metadata:
+  labels:
+{{- if .Values.enabled }}
+{{- toYaml .Values.labels | nindent 4 }}
+{{- end }}
+`,
+			expected: `metadata:
+  labels:
+{{- if .Values.enabled }}
+  {{- toYaml .Values.labels | nindent 4 }}
+{{- end }}
+`,
+		},
+		{
+			name: "include and direct calls",
+			src: `{{- define "labels" -}}
+app: web
+tier: front
+{{- end }}
+spec:
+{{- with .Values.resources }}
+{{- if .limits }}
+  resources:
+{{- include "labels" $ | indent 4 }}
+{{- nindent 4 (toYaml .) }}
+{{- end }}
+{{- end }}
+`,
+			expected: `{{- define "labels" -}}
+app: web
+tier: front
+{{- end }}
+spec:
+{{- with .Values.resources }}
+  {{- if .limits }}
+  resources:
+    {{- include "labels" $ | indent 4 }}
+    {{- nindent 4 (toYaml .) }}
+  {{- end }}
+{{- end }}
+`,
+		},
+		{
+			name: "leading whitespace reaches the output",
+			src: `{{- if .Values.enabled }}
+{{ toYaml .Values.labels | nindent 2 }}
+{{- toYaml .Values.labels }}
+{{- end }}
+`,
+			expected: `{{- if .Values.enabled }}
+{{ toYaml .Values.labels | nindent 2 }}
+{{- toYaml .Values.labels }}
+{{- end }}
+`,
+		},
+		{
+			name: "directive wins",
+			src: `{{- if .Values.enabled }}
+{{- /* helmfmt:disable=toYaml */}}
+{{- toYaml .Values.labels | nindent 2 }}
+{{- end }}
+`,
+			expected: `{{- if .Values.enabled }}
+  {{- /* helmfmt:disable=toYaml */}}
+{{- toYaml .Values.labels | nindent 2 }}
+{{- end }}
+`,
+		},
+	}
+
+	config := DefaultConfig()
+	config.YAMLAware = true
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format([]byte(tt.src), Options{Config: config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+			if err := Verify("t.yaml", []byte(tt.src), got, VerifyOptions{Values: values}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// Without the mode, the disabled rules keep their lines in place
+	src := tests[0].src
+	if got, _ := Format([]byte(src), Options{}); string(got) != src {
+		t.Errorf("expected no change by default, got:\n%s", got)
+	}
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+)
+
+// Supported values of --output-format.
+const (
+	formatText       = "text"
+	formatJSON       = "json"
+	formatSARIF      = "sarif"
+	formatJUnit      = "junit"
+	formatCheckstyle = "checkstyle"
+)
+
+var outputFormats = []string{formatText, formatJSON, formatSARIF, formatJUnit, formatCheckstyle}
+
+// File statuses reported per processed file.
+const (
+	statusFormatted   = "formatted"   // already properly formatted
+	statusUnformatted = "unformatted" // needs formatting (check, diff and stdout modes)
+	statusUpdated     = "updated"     // reformatted in place
+	statusError       = "error"       // could not be read, parsed or written
+)
+
+// Error kinds of a fileError.
+const (
+	errorSyntax = "syntax"
+	errorIO     = "io"
+	errorConfig = "config"
+	errorRender = "render" // formatting would change the rendered output
+)
+
+// fileResult is the outcome of processing a single file.
+type fileResult struct {
+	File    string              `json:"file"`
+	Status  string              `json:"status"`
+	Error   *fileError          `json:"error,omitempty"`
+	Changes []helmfmt.LineRange `json:"changes,omitempty"` // lines of the original file touched by formatting
+	Notes   []helmfmt.Note      `json:"notes,omitempty"`   // lines whose indentation reaches the rendered output, or whose trim markers changed
+
+	formatted string // formatted content, for --stdout
+	diff      string // unified diff, for --diff
+}
+
+// fileError describes why a file could not be processed. Line and Column are
+// 1-based and 0 when unknown.
+type fileError struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+// reportSummary holds the counters printed at the end of a run.
+type reportSummary struct {
+	Total       int `json:"total"`
+	Updated     int `json:"updated"`
+	Unformatted int `json:"unformatted"`
+	Errors      int `json:"errors"`
+}
+
+func summarize(results []fileResult) reportSummary {
+	s := reportSummary{Total: len(results)}
+	for _, res := range results {
+		switch res.Status {
+		case statusUpdated:
+			s.Updated++
+		case statusUnformatted:
+			s.Unformatted++
+		case statusError:
+			s.Errors++
+		}
+	}
+	return s
+}
+
+// exitCode returns the process exit code for a run with the given summary.
+func (s reportSummary) exitCode(opts runOptions) int {
+	if s.Errors > 0 || (opts.check && s.Unformatted > 0) {
+		return 1
+	}
+	return 0
+}
+
+// errorPositionRe extracts the position from text/template errors such as
+// "template: validation:3: unexpected ..." or "template: validation:3:12: ...".
+var errorPositionRe = regexp.MustCompile(`template: [^:]*:(\d+)(?::(\d+))?:`)
+
+// syntaxError builds a fileError from a template parse error.
+func syntaxError(err error) *fileError {
+	fe := &fileError{Kind: errorSyntax, Message: err.Error()}
+	var se *helmfmt.SyntaxError
+	if errors.As(err, &se) {
+		fe.Line, fe.Column = se.Line, se.Column
+	} else if m := errorPositionRe.FindStringSubmatch(fe.Message); m != nil {
+		fe.Line, _ = strconv.Atoi(m[1])
+		fe.Column, _ = strconv.Atoi(m[2])
+	}
+	return fe
+}
+
+// changedRanges returns the ranges of lines of orig that differ in formatted.
+// Pure insertions are attributed to the line they are inserted before.
+func changedRanges(orig, formatted string) []helmfmt.LineRange {
+	var ranges []helmfmt.LineRange
+	line := 1
+	ops := diffLines(splitLines(orig), splitLines(formatted))
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			line++
+			i++
+			continue
+		}
+		r := helmfmt.LineRange{Start: line, End: line}
+		for ; i < len(ops) && ops[i].kind != ' '; i++ {
+			if ops[i].kind == '-' {
+				r.End = line
+				line++
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// writeReport prints the results in the selected output format and returns
+// the exit code.
+func writeReport(results []fileResult, opts runOptions) int {
+	summary := summarize(results)
+	var err error
+	switch opts.outputFormat {
+	case formatJSON:
+		err = writeJSONReport(os.Stdout, results, summary)
+	case formatSARIF:
+		err = writeSARIFReport(os.Stdout, results)
+	case formatJUnit:
+		err = writeJUnitReport(os.Stdout, results, summary)
+	case formatCheckstyle:
+		err = writeCheckstyleReport(os.Stdout, results)
+	default:
+		writeTextReport(results, summary, opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR]  writing %s report: %v\n", opts.outputFormat, err)
+		return 1
+	}
+	return summary.exitCode(opts)
+}
+
+// writeNotes prints the notes about a file on stderr. Changes made by trim
+// rules are only listed with --verbose or --diff.
+func writeNotes(file string, notes []helmfmt.Note, opts runOptions) {
+	for _, n := range notes {
+		if _, warning := noteRule(n); warning {
+			fmt.Fprintf(os.Stderr, "[WARNING] %s:%d: %s\n", file, n.Line, n.Message)
+		} else if opts.verbose || opts.diff {
+			fmt.Fprintf(os.Stderr, "[TRIMMED] %s:%d: %s\n", file, n.Line, n.Message)
+		}
+	}
+}
+
+func writeTextReport(results []fileResult, summary reportSummary, opts runOptions) {
+	for _, res := range results {
+		writeNotes(res.File, res.Notes, opts)
+		switch {
+		case res.Status == statusError && res.Error.Kind == errorSyntax:
+			fmt.Fprintf(os.Stderr, "[ERROR]  Invalid syntax %s: %v\n", res.File, res.Error.Message)
+			continue
+		case res.Status == statusError:
+			fmt.Fprintf(os.Stderr, "[ERROR]  %s: %v\n", res.File, res.Error.Message)
+			continue
+		}
+
+		if opts.diff {
+			fmt.Print(res.diff)
+		}
+		switch {
+		case opts.check && res.Status == statusUnformatted:
+			fmt.Fprintf(os.Stderr, "[UNFORMATTED] %s\n", res.File)
+		case opts.stdout && !opts.check && !opts.diff:
+			fmt.Print(res.formatted)
+		case res.Status == statusUpdated:
+			fmt.Printf("[UPDATED] %s\n", res.File)
+		}
+	}
+
+	switch {
+	case opts.check && summary.exitCode(opts) != 0:
+		fmt.Fprintf(os.Stderr, "\n%d file(s) need formatting, %d error(s)\n", summary.Unformatted, summary.Errors)
+	case opts.check:
+		fmt.Printf("All %d file(s) are properly formatted\n", summary.Total)
+	case !opts.stdout && !opts.diff:
+		fmt.Printf("\nProcessed: %d files, Updated: %d, Errors: %d\n", summary.Total, summary.Updated, summary.Errors)
+	}
+}
+
+func writeJSONReport(w io.Writer, results []fileResult, summary reportSummary) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(struct {
+		Files   []fileResult  `json:"files"`
+		Summary reportSummary `json:"summary"`
+	}{results, summary})
+}
+
+// findingMessage describes a formatting finding for the line-oriented formats.
+func findingMessage(res fileResult, r helmfmt.LineRange) string {
+	if res.Status == statusUpdated {
+		return fmt.Sprintf("Reformatted %s", r)
+	}
+	return fmt.Sprintf("Formatting differs at %s", r)
+}
+
+// SARIF 2.1.0, the subset needed for GitHub code scanning.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		Version        string      `json:"version"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           *sarifRegion          `json:"region,omitempty"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn,omitempty"`
+		EndLine     int `json:"endLine,omitempty"`
+	}
+)
+
+// SARIF rule identifiers.
+const (
+	ruleUnformatted = "unformatted"
+	ruleSyntax      = "invalid-syntax"
+	ruleIO          = "io-error"
+	ruleConfig      = "invalid-config"
+	ruleRender      = "render-mismatch"
+	ruleWhitespace  = "leading-whitespace"
+	ruleTrim        = "trim-markers"
+	ruleTabs        = "tab-indentation"
+)
+
+// noteRule returns the rule id reported for a note, and whether the note is
+// a warning rather than a record of a change.
+func noteRule(n helmfmt.Note) (string, bool) {
+	switch n.Rule {
+	case helmfmt.NoteTrim:
+		return ruleTrim, false
+	case helmfmt.NoteTabs:
+		return ruleTabs, true
+	}
+	return ruleWhitespace, true
+}
+
+// errorRule returns the rule id reported for an error.
+func errorRule(e *fileError) string {
+	switch e.Kind {
+	case errorSyntax:
+		return ruleSyntax
+	case errorConfig:
+		return ruleConfig
+	case errorRender:
+		return ruleRender
+	default:
+		return ruleIO
+	}
+}
+
+func writeSARIFReport(w io.Writer, results []fileResult) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "helmfmt",
+			Version:        Version,
+			InformationURI: "https://github.com/digitalstudium/helmfmt",
+			Rules: []sarifRule{
+				{ID: ruleUnformatted, ShortDescription: sarifMessage{"Template is not formatted"}},
+				{ID: ruleSyntax, ShortDescription: sarifMessage{"Template has invalid syntax"}},
+				{ID: ruleIO, ShortDescription: sarifMessage{"File could not be read or written"}},
+				{ID: ruleConfig, ShortDescription: sarifMessage{"Config file of the template is invalid"}},
+				{ID: ruleRender, ShortDescription: sarifMessage{"Formatting would change the rendered output"}},
+				{ID: ruleWhitespace, ShortDescription: sarifMessage{"Indentation of the line reaches the rendered output"}},
+				{ID: ruleTrim, ShortDescription: sarifMessage{"Trim markers of the line were changed"}},
+				{ID: ruleTabs, ShortDescription: sarifMessage{"YAML line is indented with a tab"}},
+			},
+		}},
+		Results: []sarifResult{},
+	}
+
+	for _, res := range results {
+		location := func(region *sarifRegion) []sarifLocation {
+			return []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(filepath.Clean(res.File))},
+				Region:           region,
+			}}}
+		}
+
+		switch res.Status {
+		case statusError:
+			result := sarifResult{RuleID: errorRule(res.Error), Level: "error", Message: sarifMessage{res.Error.Message}, Locations: location(nil)}
+			if res.Error.Kind == errorSyntax {
+				if res.Error.Line > 0 {
+					result.Locations = location(&sarifRegion{StartLine: res.Error.Line, StartColumn: res.Error.Column})
+				}
+			}
+			run.Results = append(run.Results, result)
+		case statusUnformatted, statusUpdated:
+			level := "error"
+			if res.Status == statusUpdated {
+				level = "note"
+			}
+			for _, r := range res.Changes {
+				run.Results = append(run.Results, sarifResult{
+					RuleID:    ruleUnformatted,
+					Level:     level,
+					Message:   sarifMessage{findingMessage(res, r)},
+					Locations: location(&sarifRegion{StartLine: r.Start, EndLine: r.End}),
+				})
+			}
+		}
+		for _, n := range res.Notes {
+			rule, warning := noteRule(n)
+			level := "note"
+			if warning {
+				level = "warning"
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    rule,
+				Level:     level,
+				Message:   sarifMessage{n.Message},
+				Locations: location(&sarifRegion{StartLine: n.Line}),
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+type (
+	junitTestSuites struct {
+		XMLName xml.Name         `xml:"testsuites"`
+		Suites  []junitTestSuite `xml:"testsuite"`
+	}
+	junitTestSuite struct {
+		Name     string          `xml:"name,attr"`
+		Tests    int             `xml:"tests,attr"`
+		Failures int             `xml:"failures,attr"`
+		Errors   int             `xml:"errors,attr"`
+		Cases    []junitTestCase `xml:"testcase"`
+	}
+	junitTestCase struct {
+		Name      string        `xml:"name,attr"`
+		Classname string        `xml:"classname,attr"`
+		Failure   *junitProblem `xml:"failure,omitempty"`
+		Error     *junitProblem `xml:"error,omitempty"`
+	}
+	junitProblem struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+func writeJUnitReport(w io.Writer, results []fileResult, summary reportSummary) error {
+	suite := junitTestSuite{Name: "helmfmt", Tests: summary.Total}
+	for _, res := range results {
+		tc := junitTestCase{Name: res.File, Classname: "helmfmt"}
+		switch res.Status {
+		case statusError:
+			tc.Error = &junitProblem{Message: res.Error.Message, Type: res.Error.Kind}
+			suite.Errors++
+		case statusUnformatted:
+			var text string
+			for _, r := range res.Changes {
+				text += findingMessage(res, r) + "\n"
+			}
+			tc.Failure = &junitProblem{Message: "file is not formatted", Type: ruleUnformatted, Text: text}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	return writeXML(w, junitTestSuites{Suites: []junitTestSuite{suite}})
+}
+
+type (
+	checkstyleReport struct {
+		XMLName xml.Name         `xml:"checkstyle"`
+		Version string           `xml:"version,attr"`
+		Files   []checkstyleFile `xml:"file"`
+	}
+	checkstyleFile struct {
+		Name   string            `xml:"name,attr"`
+		Errors []checkstyleError `xml:"error"`
+	}
+	checkstyleError struct {
+		Line     int    `xml:"line,attr,omitempty"`
+		Column   int    `xml:"column,attr,omitempty"`
+		Severity string `xml:"severity,attr"`
+		Message  string `xml:"message,attr"`
+		Source   string `xml:"source,attr"`
+	}
+)
+
+func writeCheckstyleReport(w io.Writer, results []fileResult) error {
+	report := checkstyleReport{Version: "4.3"}
+	for _, res := range results {
+		file := checkstyleFile{Name: res.File}
+		switch res.Status {
+		case statusError:
+			e := checkstyleError{Severity: "error", Message: res.Error.Message, Source: "helmfmt." + errorRule(res.Error)}
+			if res.Error.Kind == errorSyntax {
+				e.Line, e.Column = res.Error.Line, res.Error.Column
+			}
+			file.Errors = append(file.Errors, e)
+		case statusUnformatted, statusUpdated:
+			severity := "error"
+			if res.Status == statusUpdated {
+				severity = "info"
+			}
+			for _, r := range res.Changes {
+				file.Errors = append(file.Errors, checkstyleError{
+					Line:     r.Start,
+					Severity: severity,
+					Message:  findingMessage(res, r),
+					Source:   "helmfmt." + ruleUnformatted,
+				})
+			}
+		}
+		for _, n := range res.Notes {
+			rule, warning := noteRule(n)
+			severity := "info"
+			if warning {
+				severity = "warning"
+			}
+			file.Errors = append(file.Errors, checkstyleError{
+				Line:     n.Line,
+				Severity: severity,
+				Message:  n.Message,
+				Source:   "helmfmt." + rule,
+			})
+		}
+		report.Files = append(report.Files, file)
+	}
+	return writeXML(w, report)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+)
+
+func TestChangedRanges(t *testing.T) {
+	orig := "{{- if .X }}\n{{- $a := 1 }}\n{{- $b := 2 }}\nfoo: bar\n{{- $c := 3 }}\n{{- end }}\n"
+	formatted := "{{- if .X }}\n  {{- $a := 1 }}\n  {{- $b := 2 }}\nfoo: bar\n  {{- $c := 3 }}\n{{- end }}\n"
+
+	got := changedRanges(orig, formatted)
+	expected := []helmfmt.LineRange{{Start: 2, End: 3}, {Start: 5, End: 5}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestSyntaxErrorPosition(t *testing.T) {
+	err := helmfmt.Validate([]byte("{{ if .X }}\nfoo\n{{ end }\n"))
+	if err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	fe := syntaxError(err)
+	if fe.Kind != errorSyntax || fe.Line != 3 {
+		t.Errorf("expected syntax error at line 3, got %+v", fe)
+	}
+
+	// The column is that of the item the message quotes
+	err = helmfmt.Validate([]byte("a: 1\nb: {{ .Y | bogus }}\n"))
+	if fe := syntaxError(err); fe.Line != 2 || fe.Column != 12 {
+		t.Errorf("expected syntax error at 2:12, got %+v", fe)
+	}
+
+	if fe := syntaxError(errors.New("no position")); fe.Line != 0 || fe.Column != 0 {
+		t.Errorf("expected unknown position, got %+v", fe)
+	}
+}
+
+func TestJSONReport(t *testing.T) {
+	results := []fileResult{
+		{File: "a.yaml", Status: statusFormatted},
+		{File: "b.yaml", Status: statusUnformatted, Changes: []helmfmt.LineRange{{Start: 2, End: 4}}, Notes: []helmfmt.Note{{Line: 3, Message: "reindented"}}},
+		{File: "c.yaml", Status: statusError, Error: &fileError{Kind: errorSyntax, Message: "boom", Line: 7}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSONReport(&buf, results, summarize(results)); err != nil {
+		t.Fatal(err)
+	}
+
+	var report struct {
+		Files   []fileResult  `json:"files"`
+		Summary reportSummary `json:"summary"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON report: %v\n%s", err, buf.String())
+	}
+	if !reflect.DeepEqual(report.Files, results) {
+		t.Errorf("expected files %+v, got %+v", results, report.Files)
+	}
+	expected := reportSummary{Total: 3, Unformatted: 1, Errors: 1}
+	if report.Summary != expected {
+		t.Errorf("expected summary %+v, got %+v", expected, report.Summary)
+	}
+}
@@ -7,14 +7,15 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
 	"gopkg.in/yaml.v3"
 )
 
 type TestCase struct {
-	Name         string  `yaml:"name"`
-	Config       *Config `yaml:"config,omitempty"` // Full config structure
-	InputFile    string  `yaml:"input_file"`
-	ExpectedFile string  `yaml:"expected_file"`
+	Name         string          `yaml:"name"`
+	Config       *helmfmt.Config `yaml:"config,omitempty"` // Full config structure
+	InputFile    string          `yaml:"input_file"`
+	ExpectedFile string          `yaml:"expected_file"`
 }
 
 func TestFormatIndentationFromTemplates(t *testing.T) {
@@ -44,7 +45,7 @@ func TestFormatIndentationFromTemplates(t *testing.T) {
 			t.Logf("Running test: %s", testCase.Name)
 
 			// Load default config and apply test-specific overrides
-			config := loadConfig()
+			config := helmfmt.DefaultConfig()
 			if testCase.Config != nil {
 				// Merge test config with default config
 				if testCase.Config.IndentSize != 0 {
@@ -59,6 +60,10 @@ func TestFormatIndentationFromTemplates(t *testing.T) {
 						config.Rules.Indent[ruleName] = ruleConfig
 					}
 				}
+				// Merge spacing rules
+				for ruleName, ruleConfig := range testCase.Config.Rules.Spacing {
+					config.Rules.Spacing[ruleName] = ruleConfig
+				}
 			}
 
 			// Read input file
@@ -76,8 +81,11 @@ func TestFormatIndentationFromTemplates(t *testing.T) {
 			}
 
 			// Test 1: Direct formatting (file mode)
-			result := formatIndentation(string(inputContent), config, testCase.InputFile)
-			result = ensureTrailingNewline(result)
+			out, err := helmfmt.Format(inputContent, helmfmt.Options{Config: config, Filename: testCase.InputFile})
+			result := string(out)
+			if err != nil {
+				t.Fatalf("Failed to format %s: %v", testCase.InputFile, err)
+			}
 			expected := string(expectedContent)
 
 			// Compare result
@@ -113,8 +121,8 @@ func TestFormatIndentationFromTemplates(t *testing.T) {
 						w.Close()
 					}()
 
-					// pass check=false and assert no error
-					if err := processStdin(config, false); err != nil {
+					// format (no check/diff) and assert no error
+					if err := processStdin(staticConfig(config), runOptions{outputFormat: formatText}); err != nil {
 						t.Fatalf("processStdin failed: %v", err)
 					}
 
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/digitalstudium/helmfmt/pkg/helmfmt"
+	"gopkg.in/yaml.v3"
+)
+
+// Values of --verify.
+const (
+	verifyExact      = "exact"
+	verifyWhitespace = "whitespace"
+)
+
+// renderVerifier checks that formatting doesn't change the rendered output of
+// templates, see helmfmt.Verify. Templates are rendered with the values of
+// their chart, overridden by the --values files.
+type renderVerifier struct {
+	whitespace bool
+	values     map[string]interface{} // merged --values files
+
+	mu     sync.Mutex
+	charts map[string]*renderChart // by chart root, "" outside charts
+}
+
+// renderChart is what the templates of a chart are rendered with.
+type renderChart struct {
+	opts helmfmt.VerifyOptions
+	err  error
+}
+
+func newRenderVerifier(mode string, valuesFiles []string) (*renderVerifier, error) {
+	if mode != verifyExact && mode != verifyWhitespace {
+		return nil, fmt.Errorf("--verify must be %s or %s, got %q", verifyExact, verifyWhitespace, mode)
+	}
+	v := &renderVerifier{
+		whitespace: mode == verifyWhitespace,
+		values:     map[string]interface{}{},
+		charts:     make(map[string]*renderChart),
+	}
+	for _, path := range valuesFiles {
+		values, err := readValues(path)
+		if err != nil {
+			return nil, err
+		}
+		mergeValues(v.values, values)
+	}
+	return v, nil
+}
+
+// verify returns an error if formatted, the formatted content of the file
+// called name, renders differently from orig.
+func (v *renderVerifier) verify(name, orig, formatted string) error {
+	dir := "."
+	if name != "<stdin>" {
+		dir = filepath.Dir(name)
+	}
+	root := chartRootOf(dir)
+	chart, err := v.chart(root)
+	if err != nil {
+		return err
+	}
+
+	templateName := filepath.Base(name)
+	if root != "" && name != "<stdin>" {
+		if rel, err := filepath.Rel(root, name); err == nil {
+			templateName = filepath.ToSlash(rel)
+		}
+	}
+	opts := chart.opts
+	opts.Whitespace = v.whitespace
+	return helmfmt.Verify(templateName, []byte(orig), []byte(formatted), opts)
+}
+
+// chart returns the render options of the chart rooted at root, loaded once.
+// Its templates are read as they are on the first call, before any of them
+// is rewritten.
+func (v *renderVerifier) chart(root string) (*renderChart, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok := v.charts[root]; ok {
+		return c, c.err
+	}
+	c := &renderChart{}
+	c.opts, c.err = loadRenderChart(root, v.values)
+	v.charts[root] = c
+	return c, c.err
+}
+
+// loadRenderChart reads the values, Chart.yaml and templates of the chart
+// rooted at root, "" for none, and merges overrides over its values.
+func loadRenderChart(root string, overrides map[string]interface{}) (helmfmt.VerifyOptions, error) {
+	opts := helmfmt.VerifyOptions{
+		Templates: make(map[string][]byte),
+		Values:    map[string]interface{}{},
+		Chart:     map[string]interface{}{},
+	}
+	if root != "" {
+		values, err := readValues(filepath.Join(root, "values.yaml"))
+		if err != nil && !os.IsNotExist(err) {
+			return opts, err
+		}
+		mergeValues(opts.Values, values)
+
+		chart, err := readValues(filepath.Join(root, "Chart.yaml"))
+		if err != nil {
+			return opts, err
+		}
+		for k, val := range chart {
+			r, size := utf8.DecodeRuneInString(k)
+			opts.Chart[string(unicode.ToUpper(r))+k[size:]] = val
+		}
+
+		templates := filepath.Join(root, "templates")
+		err = filepath.WalkDir(templates, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			opts.Templates[filepath.ToSlash(rel)] = b
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return opts, err
+		}
+	}
+	mergeValues(opts.Values, overrides)
+	return opts, nil
+}
+
+// chartRootOf returns the root of the chart enclosing dir, or "" if there is
+// none.
+func chartRootOf(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for d := abs; ; d = filepath.Dir(d) {
+		if isChartRoot(d) {
+			// Keep the path relative if dir was, for template names
+			if rel, err := filepath.Rel(abs, d); err == nil && !filepath.IsAbs(dir) {
+				return filepath.Join(dir, rel)
+			}
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return ""
+		}
+	}
+}
+
+// readValues reads a YAML values file; an empty file holds no values.
+func readValues(path string) (map[string]interface{}, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	return values, nil
+}
+
+// mergeValues merges src into dst the way Helm merges values files: mappings
+// key by key, any other value replacing the one in dst.
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if m, ok := v.(map[string]interface{}); ok {
+			if sub, ok := dst[k].(map[string]interface{}); ok {
+				mergeValues(sub, m)
+				continue
+			}
+			copied := map[string]interface{}{}
+			mergeValues(copied, m)
+			dst[k] = copied
+			continue
+		}
+		dst[k] = v
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderVerifier(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"chart/Chart.yaml":             "name: web\nappVersion: \"1.0\"\n",
+		"chart/values.yaml":            "image:\n  tag: latest\n  pullPolicy: Always\nreplicas: 1\n",
+		"chart/templates/_helpers.tpl": "{{- define \"web.image\" -}}\n{{ .Values.image.tag }}-{{ .Chart.AppVersion }}\n{{- end }}\n",
+		"override.yaml":                "image:\n  tag: \"\"\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := filepath.Join(dir, "chart", "templates", "deployment.yaml")
+
+	// The formatted version only changes the output if the tag is set
+	orig := "image: x\n{{- if .Values.image.tag }}\n{{ include \"web.image\" . }}\n{{- end }}\n"
+	formatted := "image: x\n{{- if .Values.image.tag }}\n  {{ include \"web.image\" . }}\n{{- end }}\n"
+
+	v, err := newRenderVerifier(verifyExact, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.verify(file, orig, formatted)
+	if err == nil || !strings.Contains(err.Error(), `is now "  latest-1.0"`) {
+		t.Errorf("expected a difference using the chart values and Chart.yaml, got %v", err)
+	}
+
+	v, err = newRenderVerifier(verifyExact, []string{filepath.Join(dir, "override.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.verify(file, orig, formatted); err != nil {
+		t.Errorf("expected the values file to disable the block, got %v", err)
+	}
+	values, _ := v.chart(chartRootOf(filepath.Dir(file)))
+	if image := values.opts.Values["image"].(map[string]interface{}); image["pullPolicy"] != "Always" || image["tag"] != "" {
+		t.Errorf("expected the values to be merged key by key, got %v", image)
+	}
+
+	if _, err := newRenderVerifier("loose", nil); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+}